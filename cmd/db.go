@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tidyoux/chatbot/db"
+)
+
+const (
+	// the backups are named after their time, e.g. chatbot-20060102-150405.jsonl.
+	backupPrefix = "chatbot-"
+	backupExt    = ".jsonl"
+)
+
+var (
+	dbCmd = &cobra.Command{
+		Use:   "db",
+		Short: "Manages the database",
+	}
+
+	dbExportCmd = &cobra.Command{
+		Use:   "export [file]",
+		Short: "Exports all the keys as JSON lines, to stdout unless a file is given",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbExport(args)
+		},
+	}
+
+	dbImportCmd = &cobra.Command{
+		Use:   "import [file]",
+		Short: "Imports the keys exported, from stdin unless a file is given",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbImport(args)
+		},
+	}
+
+	dbLsCmd = &cobra.Command{
+		Use:   "ls [namespace [prefix]]",
+		Short: "Lists the namespaces, or the keys of a namespace",
+		Args:  cobra.MaximumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbLs(args)
+		},
+	}
+
+	dbGetCmd = &cobra.Command{
+		Use:   "get <namespace> <key>",
+		Short: "Prints the value of a key",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbGet(args[0], args[1])
+		},
+	}
+
+	dbStatsCmd = &cobra.Command{
+		Use:   "stats",
+		Short: "Prints the number of keys and bytes of each namespace",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbStats()
+		},
+	}
+
+	dbMigrateDryRun bool
+	dbMigrateCmd    = &cobra.Command{
+		Use:   "migrate",
+		Short: "Runs the pending migrations of the stored data, which the bot also does when started",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbMigrate()
+		},
+	}
+
+	dbRotateKeyCmd = &cobra.Command{
+		Use:   "rotate-key",
+		Short: "Re-encrypts the values with the key of --db-key-file, decrypting them with --db-old-key-files",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbRotateKey()
+		},
+	}
+
+	dbRmAll bool
+	dbRmCmd = &cobra.Command{
+		Use:   "rm <namespace> [key...]",
+		Short: "Deletes keys of a namespace, or all of them with --all",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbRm(args[0], args[1:])
+		},
+	}
+)
+
+func init() {
+	dbMigrateCmd.Flags().BoolVar(&dbMigrateDryRun, "dry-run", false, "print the migrations without writing anything")
+	dbRmCmd.Flags().BoolVar(&dbRmAll, "all", false, "delete all the keys of the namespace")
+	dbCmd.AddCommand(dbExportCmd, dbImportCmd, dbLsCmd, dbGetCmd, dbStatsCmd, dbMigrateCmd, dbRotateKeyCmd, dbRmCmd)
+	rootCmd.AddCommand(dbCmd)
+}
+
+func dbExport(args []string) error {
+	dbReadOnly = true
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if len(args) == 0 {
+		_, err = database.Export(os.Stdout)
+		return err
+	}
+
+	count, err := database.Backup(args[0])
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Exported %d keys to %s", count, args[0])
+	return nil
+}
+
+func dbImport(args []string) error {
+	var r io.Reader = os.Stdin
+	if len(args) > 0 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	count, err := db.Import(database.Store(), r)
+	log.Printf("Imported %d keys", count)
+	return err
+}
+
+// namespaceName returns the name of a namespace for display, quoted since
+// internal ones aren't printable, or its hash if it's unknown.
+func namespaceName(name, hash string) string {
+	if len(name) == 0 {
+		return hash
+	}
+	return strconv.Quote(name)
+}
+
+func dbLs(args []string) error {
+	dbReadOnly = true
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if len(args) == 0 {
+		stats, err := db.Stats(database.Store())
+		if err != nil {
+			return err
+		}
+
+		for _, s := range stats {
+			fmt.Printf("%s\t%s\n", s.Hash, namespaceName(s.Name, s.Hash))
+		}
+		return nil
+	}
+
+	var prefix []byte
+	if len(args) > 1 {
+		prefix = []byte(args[1])
+	}
+
+	ns, err := db.Namespace(database.Store(), args[0])
+	if err != nil {
+		return err
+	}
+
+	keys, err := ns.Keys(prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		fmt.Println(strconv.Quote(string(key)))
+	}
+	return nil
+}
+
+func dbGet(namespace, key string) error {
+	dbReadOnly = true
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ns, err := db.Namespace(database.Store(), namespace)
+	if err != nil {
+		return err
+	}
+
+	value, err := ns.Get([]byte(key))
+	if err != nil {
+		return err
+	}
+
+	if value == nil {
+		return fmt.Errorf("key %q not found", key)
+	}
+
+	_, err = os.Stdout.Write(value)
+	return err
+}
+
+func dbStats() error {
+	dbReadOnly = true
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	stats, err := db.Stats(database.Store())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tKEYS\tBYTES")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", namespaceName(s.Name, s.Hash), s.Keys, s.Bytes)
+	}
+	return w.Flush()
+}
+
+func dbRm(namespace string, keys []string) error {
+	if len(keys) == 0 && !dbRmAll {
+		return errors.New("no keys to delete, use --all to delete all of them")
+	}
+
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ns, err := db.Namespace(database.Store(), namespace)
+	if err != nil {
+		return err
+	}
+
+	if dbRmAll {
+		count, err := ns.Clear()
+		log.Printf("Deleted %d keys", count)
+		return err
+	}
+
+	b := ns.NewBatch()
+	for _, key := range keys {
+		b.Delete([]byte(key))
+	}
+	return b.Write()
+}
+
+func dbMigrate() error {
+	dbReadOnly = dbReadOnly || dbMigrateDryRun
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	return migrateDB(database, dbMigrateDryRun)
+}
+
+func migrateDB(database *db.Database, dryRun bool) error {
+	results, err := db.Migrate(database.Store(), dryRun)
+	for _, r := range results {
+		verb := "Migrated"
+		if dryRun {
+			verb = "Would migrate"
+		}
+		log.Printf("%s %s from version %d to %d, %d writes", verb, r.Namespace, r.From, r.To, r.Writes)
+	}
+	return err
+}
+
+func dbRotateKey() error {
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	count, err := db.Rotate(database.Store())
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Re-encrypted %d values", count)
+	return nil
+}
+
+// backupDB backs the database up to dir every interval until ctx is done,
+// keeping the newest keep backups, all of them if keep isn't positive.
+func backupDB(ctx context.Context, database *db.Database, dir string, interval time.Duration, keep int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("%s%s%s", backupPrefix, time.Now().Format("20060102-150405"), backupExt))
+		count, err := database.Backup(path)
+		if err != nil {
+			log.Println("backup", err)
+			continue
+		}
+		log.Printf("Backed up %d keys to %s", count, path)
+
+		err = pruneBackups(dir, keep)
+		if err != nil {
+			log.Println("backup", err)
+		}
+	}
+}
+
+// pruneBackups deletes the backups of dir but the newest keep ones.
+func pruneBackups(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasPrefix(f.Name(), backupPrefix) && strings.HasSuffix(f.Name(), backupExt) {
+			names = append(names, f.Name())
+		}
+	}
+
+	// the names sort by the time of the backups.
+	sort.Strings(names)
+	for len(names) > keep {
+		err = os.Remove(filepath.Join(dir, names[0]))
+		if err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
@@ -1,22 +1,73 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/go-chat-bot/bot"
 	"github.com/spf13/cobra"
+	"github.com/tidyoux/chatbot/db"
+	"github.com/tidyoux/chatbot/plugins"
+	"github.com/tidyoux/chatbot/plugins/alias"
+	"github.com/tidyoux/chatbot/plugins/audit"
+	dbplugin "github.com/tidyoux/chatbot/plugins/db"
+	"github.com/tidyoux/chatbot/plugins/lifeline"
+	"github.com/tidyoux/chatbot/plugins/schedule"
+	"github.com/tidyoux/chatbot/utils"
 	"golang.org/x/net/proxy"
 	tgbotapi "gopkg.in/telegram-bot-api.v4"
 )
 
+const (
+	dbKeyEnv = "CHATBOT_DB_KEY"
+)
+
 var (
 	token     string
 	debug     bool
 	proxyAddr string
 
+	dbPath        string
+	dbBackend     string
+	dbCacheSize   int
+	dbWriteBuffer int
+	dbReadOnly    bool
+	dbSweep       time.Duration
+
+	dbKeyFile     string
+	dbOldKeyFiles []string
+	dbEncrypt     []string
+
+	dbConfig dbplugin.Config
+
+	backupDir      string
+	backupInterval time.Duration
+	backupKeep     int
+
+	admins         []string
+	auditRedact    []string
+	auditRetention time.Duration
+
+	timeout         time.Duration
+	commandTimeouts map[string]string
+
+	httpTimeout time.Duration
+	httpMaxBody int64
+	httpRetries int
+
+	httpCacheSize    int
+	httpCachePersist bool
+
+	lifelineDir string
+
 	rootCmd = &cobra.Command{
 		Use: "chatbot",
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -29,20 +80,185 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&token, "token", "t", "", "the telegram api token")
 	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "set debug mode")
 	rootCmd.PersistentFlags().StringVarP(&proxyAddr, "proxy", "p", "", "the socks5 proxy address, e.g.: 127.0.0.1:1080")
+	rootCmd.PersistentFlags().StringVar(&dbPath, "db", "db/", "the directory of the database")
+	rootCmd.PersistentFlags().StringVar(&dbBackend, "db-backend", db.LevelDB, "the storage backend of the database, leveldb or memory")
+	rootCmd.PersistentFlags().IntVar(&dbCacheSize, "db-cache-size", 0, "the size of the database block cache in bytes, 0 for the default")
+	rootCmd.PersistentFlags().IntVar(&dbWriteBuffer, "db-write-buffer", 0, "the size of the database write buffer in bytes, 0 for the default")
+	rootCmd.PersistentFlags().BoolVar(&dbReadOnly, "db-read-only", false, "open the database read-only")
+	rootCmd.PersistentFlags().DurationVar(&dbSweep, "db-sweep-interval", db.DefaultSweepInterval, "how often expired database keys are deleted, negative for never")
+	rootCmd.PersistentFlags().StringVar(&dbKeyFile, "db-key-file", "", "the file of the database encryption key, 32 bytes in hex or base64, or set "+dbKeyEnv)
+	rootCmd.PersistentFlags().StringSliceVar(&dbOldKeyFiles, "db-old-key-files", nil, "the files of the previous encryption keys, until rotated")
+	rootCmd.PersistentFlags().StringSliceVar(&dbEncrypt, "db-encrypt", nil, "the namespaces whose values are encrypted, e.g.: db,lifeline")
+	rootCmd.PersistentFlags().StringSliceVar(&admins, "admin", nil, "the telegram user ids allowed to run admin commands")
+	rootCmd.Flags().Int64Var(&dbConfig.UserQuota, "db-user-quota", dbplugin.DefaultUserQuota, "the bytes a user may store with the db command, 0 for no limit")
+	rootCmd.Flags().Int64Var(&dbConfig.ChatQuota, "db-chat-quota", dbplugin.DefaultChatQuota, "the bytes a chat may store with the db command, 0 for no limit")
+	rootCmd.Flags().Int64Var(&dbConfig.GlobalQuota, "db-global-quota", dbplugin.DefaultGlobalQuota, "the bytes admins may store globally with the db command, 0 for no limit")
+	rootCmd.Flags().IntVar(&dbConfig.History, "db-history", dbplugin.DefaultHistory, "how many versions of each key the db command keeps")
+	rootCmd.Flags().StringVar(&backupDir, "backup-dir", "", "the directory the database is backed up to while running, none if empty")
+	rootCmd.Flags().DurationVar(&backupInterval, "backup-interval", 24*time.Hour, "how often the database is backed up")
+	rootCmd.Flags().IntVar(&backupKeep, "backup-keep", 7, "how many backups are kept, 0 keeps them all")
+	rootCmd.Flags().StringSliceVar(&auditRedact, "audit-redact", audit.DefaultRedact, "the commands whose arguments aren't audited")
+	rootCmd.Flags().DurationVar(&auditRetention, "audit-retention", 30*24*time.Hour, "how long audit entries are kept, 0 keeps them forever")
+	rootCmd.Flags().DurationVar(&timeout, "timeout", plugins.DefaultTimeout, "how long a command may run, 0 for no limit")
+	rootCmd.Flags().StringToStringVar(&commandTimeouts, "command-timeout", map[string]string{"lifeline": "10m"}, "how long the given commands may run, e.g.: lisp=5s,weather=10s")
+	rootCmd.Flags().DurationVar(&httpTimeout, "http-timeout", utils.DefaultConfig().Timeout, "the timeout of http requests made by plugins")
+	rootCmd.Flags().Int64Var(&httpMaxBody, "http-max-body", utils.DefaultConfig().MaxBodySize, "the largest http response body read by plugins, in bytes")
+	rootCmd.Flags().IntVar(&httpRetries, "http-retries", utils.DefaultConfig().Retries, "how many times plugins retry failed idempotent http requests")
+	rootCmd.Flags().IntVar(&httpCacheSize, "http-cache-size", utils.DefaultConfig().CacheSize, "how many http responses are cached in memory")
+	rootCmd.Flags().BoolVar(&httpCachePersist, "http-cache-persist", false, "also cache http responses in the db")
+	rootCmd.Flags().StringVar(&lifelineDir, "lifeline-dir", "", "the directory of the Twee stories played by the lifeline command, besides the built-in one")
 }
 
 func main() {
 	rootCmd.Execute()
 }
 
+func setDBKeys() error {
+	var key []byte
+	var err error
+	switch {
+	case len(dbKeyFile) > 0:
+		key, err = db.LoadKey(dbKeyFile)
+	case len(os.Getenv(dbKeyEnv)) > 0:
+		key, err = db.ParseKey(os.Getenv(dbKeyEnv))
+	default:
+		if len(dbEncrypt) > 0 {
+			return fmt.Errorf("encrypting %s needs --db-key-file or %s", strings.Join(dbEncrypt, ","), dbKeyEnv)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var old [][]byte
+	for _, path := range dbOldKeyFiles {
+		k, err := db.LoadKey(path)
+		if err != nil {
+			return err
+		}
+		old = append(old, k)
+	}
+
+	db.Encrypt(dbEncrypt...)
+	return db.SetKeys(key, old...)
+}
+
+func openDB() (*db.Database, error) {
+	err := setDBKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.Open(dbPath, &db.Options{
+		Backend:         dbBackend,
+		CacheSize:       dbCacheSize,
+		WriteBufferSize: dbWriteBuffer,
+		ReadOnly:        dbReadOnly,
+		SweepInterval:   dbSweep,
+	})
+}
+
 func start() error {
+	database, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if !dbReadOnly {
+		if len(dbEncrypt) > 0 {
+			count, err := db.EncryptPlaintext(database.Store())
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				log.Printf("Encrypted %d values", count)
+			}
+		}
+
+		err = migrateDB(database, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	dbplugin.SetStore(database.Store())
+	dbplugin.Configure(dbConfig)
+	lifeline.SetStore(database.Store())
+	if len(lifelineDir) > 0 {
+		err = lifeline.LoadStories(lifelineDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(backupDir) > 0 && backupInterval > 0 {
+		err = os.MkdirAll(backupDir, 0700)
+		if err != nil {
+			return err
+		}
+
+		// the backups stop before the database is closed.
+		ctx, cancel := context.WithCancel(plugins.Background())
+		backupDone := make(chan struct{})
+		go func() {
+			defer close(backupDone)
+			backupDB(ctx, database, backupDir, backupInterval, backupKeep)
+		}()
+		defer func() {
+			cancel()
+			<-backupDone
+		}()
+	}
+
+	plugins.SetAdmins(admins)
+	audit.Configure(audit.Config{
+		Redact:    auditRedact,
+		Retention: auditRetention,
+	})
+
+	perCommand := make(map[string]time.Duration)
+	for command, v := range commandTimeouts {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid timeout of command %s: %v", command, err)
+		}
+		perCommand[command] = d
+	}
+
+	// Timeout runs the rest of the chain in its own goroutine, whose panics
+	// Recover must catch.
+	var middlewares []plugins.Middleware
+	if debug {
+		middlewares = append(middlewares, plugins.Logger())
+	}
+	middlewares = append(middlewares,
+		audit.Middleware(),
+		plugins.Timeout(timeout, perCommand),
+		plugins.Recover())
+	plugins.Use(middlewares...)
+
+	httpConfig := utils.DefaultConfig()
+	httpConfig.Timeout = httpTimeout
+	httpConfig.MaxBodySize = httpMaxBody
+	httpConfig.Retries = httpRetries
+	httpConfig.CacheSize = httpCacheSize
+	httpConfig.PersistCache = httpCachePersist
+
 	client := &http.Client{}
 	if len(proxyAddr) > 0 {
-		dialer, _ := proxy.SOCKS5("tcp", proxyAddr, nil, proxy.Direct)
+		dialer, err := proxy.SOCKS5("tcp", proxyAddr, nil, proxy.Direct)
+		if err != nil {
+			return err
+		}
+
 		client.Transport = &http.Transport{
 			Dial: dialer.Dial,
 		}
+		httpConfig.Dial = dialer.Dial
 	}
+	utils.Configure(httpConfig)
 	return run(token, debug, client)
 }
 
@@ -83,24 +299,52 @@ func run(token string, debug bool, client *http.Client) error {
 		},
 	})
 	b.Disable([]string{"cmd", "url"})
+	plugins.SetSender(func(channel, message string) {
+		b.SendMessage(channel, message, nil)
+	})
+	plugins.StartDialogs()
+	lifeline.Start()
 
-	for update := range updates {
-		target := &bot.ChannelData{
-			Protocol:  "telegram",
-			Server:    "telegram",
-			Channel:   strconv.FormatInt(update.Message.Chat.ID, 10),
-			IsPrivate: update.Message.Chat.IsPrivate()}
-		name := []string{update.Message.From.FirstName, update.Message.From.LastName}
-		message := &bot.Message{
-			Text: update.Message.Text,
+	receive := func(target *bot.ChannelData, text string, user *bot.User) {
+		text, err := alias.Expand(target.Channel, user.ID, text)
+		if err != nil {
+			b.SendMessage(target.Channel, err.Error(), user)
+			return
 		}
 
-		go b.MessageReceived(target, message, &bot.User{
-			ID:       strconv.Itoa(update.Message.From.ID),
-			Nick:     update.Message.From.UserName,
-			RealName: strings.Join(name, " ")})
+		b.MessageReceived(target, &bot.Message{Text: text}, user)
+	}
+
+	err = schedule.Start(receive)
+	if err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	for {
+		select {
+		case update := <-updates:
+			target := &bot.ChannelData{
+				Protocol:  "telegram",
+				Server:    "telegram",
+				Channel:   strconv.FormatInt(update.Message.Chat.ID, 10),
+				IsPrivate: update.Message.Chat.IsPrivate()}
+			name := []string{update.Message.From.FirstName, update.Message.From.LastName}
+			user := &bot.User{
+				ID:       strconv.Itoa(update.Message.From.ID),
+				Nick:     update.Message.From.UserName,
+				RealName: strings.Join(name, " ")}
+
+			go receive(target, update.Message.Text, user)
+		case sig := <-signals:
+			log.Printf("Received %v, shutting down", sig)
+			plugins.Shutdown()
+			b.Close()
+			return nil
+		}
 	}
-	return nil
 }
 
 func newOneTimeReplyKeyboard(labels [][]string) tgbotapi.ReplyKeyboardMarkup {
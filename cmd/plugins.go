@@ -1,11 +1,10 @@
 package main
 
 import (
+	_ "github.com/tidyoux/chatbot/plugins/cancel"
 	_ "github.com/tidyoux/chatbot/plugins/crypto"
-	_ "github.com/tidyoux/chatbot/plugins/db"
 	_ "github.com/tidyoux/chatbot/plugins/encode"
 	_ "github.com/tidyoux/chatbot/plugins/hello"
-	_ "github.com/tidyoux/chatbot/plugins/lifeline"
 	_ "github.com/tidyoux/chatbot/plugins/lisp"
 	_ "github.com/tidyoux/chatbot/plugins/rand"
 	_ "github.com/tidyoux/chatbot/plugins/uptime"
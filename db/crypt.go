@@ -0,0 +1,274 @@
+package db
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+const (
+	// KeySize is the size of the encryption keys, for AES-256.
+	KeySize = 32
+
+	keyIDSize = 4
+)
+
+var (
+	// ErrNoKey is returned when writing to an encrypted namespace, or reading
+	// an encrypted value, without the key.
+	ErrNoKey = errors.New("db: no encryption key")
+
+	// ErrNotEncrypted is returned when reading a value of an encrypted
+	// namespace written before it was, until EncryptPlaintext encrypts it.
+	ErrNotEncrypted = errors.New("db: value isn't encrypted")
+
+	// sealedPrefix starts the encrypted values, followed by the id of the
+	// key, the nonce and the sealed value.
+	sealedPrefix = []byte("\x00enc1")
+
+	cryptMu   sync.RWMutex
+	primary   *aeadKey
+	keys      = make(map[string]*aeadKey)
+	encrypted = make(map[string]bool)
+)
+
+type aeadKey struct {
+	id   []byte
+	aead cipher.AEAD
+}
+
+func newAEADKey(key []byte) (*aeadKey, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("db: encryption key must be %d bytes", KeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(key)
+	return &aeadKey{id: hash[:keyIDSize], aead: aead}, nil
+}
+
+// ParseKey parses a key encoded in hex or base64.
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if key, err := hex.DecodeString(s); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("db: encryption key must be %d bytes encoded in hex or base64", KeySize)
+	}
+	return key, nil
+}
+
+// LoadKey reads the key of the file at path, see ParseKey.
+func LoadKey(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKey(string(data))
+}
+
+// SetKeys sets the key values are encrypted with, and the old keys which
+// may still decrypt values until they're rotated.
+func SetKeys(key []byte, old ...[]byte) error {
+	p, err := newAEADKey(key)
+	if err != nil {
+		return err
+	}
+
+	m := map[string]*aeadKey{string(p.id): p}
+	for _, o := range old {
+		k, err := newAEADKey(o)
+		if err != nil {
+			return err
+		}
+		m[string(k.id)] = k
+	}
+
+	cryptMu.Lock()
+	defer cryptMu.Unlock()
+	primary = p
+	keys = m
+	return nil
+}
+
+// Encrypt makes the values written to the namespaces encrypted.
+func Encrypt(namespaces ...string) {
+	cryptMu.Lock()
+	defer cryptMu.Unlock()
+	for _, namespace := range namespaces {
+		encrypted[string(hashNamespace(namespace))] = true
+	}
+}
+
+func (db *DB) encrypted() bool {
+	return isEncrypted(db.namespace)
+}
+
+// isEncrypted reports whether the namespace of key, or the namespace
+// itself, is encrypted.
+func isEncrypted(key []byte) bool {
+	if len(key) < namespaceSize {
+		return false
+	}
+
+	cryptMu.RLock()
+	defer cryptMu.RUnlock()
+	return encrypted[string(key[:namespaceSize])]
+}
+
+// seal encrypts the value of key, with its namespace, binding it to the key.
+func seal(key, value []byte) ([]byte, error) {
+	cryptMu.RLock()
+	p := primary
+	cryptMu.RUnlock()
+
+	if p == nil {
+		return nil, ErrNoKey
+	}
+
+	nonce := make([]byte, p.aead.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := append(append(append([]byte{}, sealedPrefix...), p.id...), nonce...)
+	return p.aead.Seal(sealed, nonce, value, key), nil
+}
+
+// unseal decrypts the value of key if its namespace is encrypted.
+func unseal(key, value []byte) ([]byte, error) {
+	if !isEncrypted(key) {
+		return value, nil
+	}
+
+	if !bytes.HasPrefix(value, sealedPrefix) {
+		return nil, ErrNotEncrypted
+	}
+	return open(key, value)
+}
+
+// open decrypts the sealed value of key.
+func open(key, value []byte) ([]byte, error) {
+	value = value[len(sealedPrefix):]
+	if len(value) < keyIDSize {
+		return nil, errors.New("db: invalid encrypted value")
+	}
+
+	cryptMu.RLock()
+	k, ok := keys[string(value[:keyIDSize])]
+	cryptMu.RUnlock()
+
+	if !ok {
+		return nil, ErrNoKey
+	}
+
+	value = value[keyIDSize:]
+	size := k.aead.NonceSize()
+	if len(value) < size {
+		return nil, errors.New("db: invalid encrypted value")
+	}
+
+	plain, err := k.aead.Open(nil, value[:size], value[size:], key)
+	if err != nil {
+		return nil, fmt.Errorf("db: decrypt: %v", err)
+	}
+	return plain, nil
+}
+
+// sealOps returns ops with the values of the namespace keys encrypted, if
+// the namespace is.
+func (db *DB) sealOps(ops []Op) ([]Op, error) {
+	if !db.encrypted() {
+		return ops, nil
+	}
+
+	sealed := make([]Op, len(ops))
+	for i, op := range ops {
+		if !op.Delete && bytes.HasPrefix(op.Key, db.namespace) {
+			var err error
+			op.Value, err = seal(op.Key, op.Value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		sealed[i] = op
+	}
+	return sealed, nil
+}
+
+// Rotate re-encrypts the values of the encrypted namespaces of store with
+// the current key, encrypting those written in plaintext along, returning
+// how many.
+func Rotate(store Store) (int, error) {
+	return reseal(store, true)
+}
+
+// EncryptPlaintext encrypts the values of the encrypted namespaces of store
+// written in plaintext, before they were encrypted, returning how many.
+func EncryptPlaintext(store Store) (int, error) {
+	return reseal(store, false)
+}
+
+func reseal(store Store, rotate bool) (int, error) {
+	var ops []Op
+	var err error
+	iterErr := store.Iterate(nil, func(key, value []byte) bool {
+		if !isEncrypted(key) {
+			return true
+		}
+
+		// The values written before the namespace was encrypted are the
+		// only ones without the prefix.
+		if bytes.HasPrefix(value, sealedPrefix) {
+			if !rotate {
+				return true
+			}
+
+			value, err = open(key, value)
+			if err != nil {
+				return false
+			}
+		}
+
+		value, err = seal(key, value)
+		if err != nil {
+			return false
+		}
+
+		ops = append(ops, Op{Key: key, Value: value})
+		return true
+	})
+	if iterErr != nil {
+		return 0, iterErr
+	}
+	if err != nil || len(ops) == 0 {
+		return 0, err
+	}
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	return len(ops), store.Write(ops)
+}
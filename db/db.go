@@ -2,54 +2,360 @@ package db
 
 import (
 	"crypto/sha256"
-
-	"github.com/syndtr/goleveldb/leveldb"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
 )
 
 const (
-	dbPath = "db/"
+	LevelDB = "leveldb"
+	Memory  = "memory"
 )
 
+// ErrNotOpen is returned when using a namespace of the default store before
+// Open or after Close.
+var ErrNotOpen = errors.New("db: database is not open")
+
+// Options configures the database opened by Open.
+type Options struct {
+	// Backend is the store used, LevelDB, the default, or Memory.
+	Backend string
+
+	// CacheSize is the size of the block cache in bytes, zero for the
+	// leveldb default.
+	CacheSize int
+
+	// WriteBufferSize is the size of the memtable in bytes, zero for the
+	// leveldb default.
+	WriteBufferSize int
+
+	// ReadOnly opens the database without allowing writes.
+	ReadOnly bool
+
+	// SweepInterval is how often the expired keys are deleted, zero for
+	// DefaultSweepInterval and negative for never.
+	SweepInterval time.Duration
+}
+
+// Database is the opened store the namespaces are stored in by default.
+type Database struct {
+	path  string
+	store Store
+	done  chan struct{}
+}
+
 var (
-	dbInstance *leveldb.DB
+	instanceMu sync.RWMutex
+	dbInstance Store
 )
 
-func init() {
-	db, err := leveldb.OpenFile(dbPath, nil)
+// Open opens the database at path with the configured backend, creating it
+// unless read-only, and makes it the default store of the namespaces. Only
+// one database is open at a time.
+func Open(path string, o *Options) (*Database, error) {
+	if o == nil {
+		o = &Options{}
+	}
+
+	instanceMu.Lock()
+	defer instanceMu.Unlock()
+
+	if dbInstance != nil {
+		return nil, errors.New("db: a database is already open")
+	}
+
+	var store Store
+	switch o.Backend {
+	case "", LevelDB:
+		var err error
+		store, err = OpenLevelDB(path, o)
+		if err != nil {
+			return nil, fmt.Errorf("db: open %s: %v", path, err)
+		}
+	case Memory:
+		store = NewMemory()
+	default:
+		return nil, fmt.Errorf("db: unknown backend %s", o.Backend)
+	}
+
+	dbInstance = store
+	d := &Database{
+		path:  path,
+		store: store,
+		done:  make(chan struct{}),
+	}
+
+	interval := o.SweepInterval
+	if interval == 0 {
+		interval = DefaultSweepInterval
+	}
+	if interval > 0 && !o.ReadOnly {
+		go d.janitor(interval)
+	}
+	return d, nil
+}
+
+// Store returns the store of the database.
+func (d *Database) Store() Store {
+	return d.store
+}
+
+// Close closes the database, the namespaces can't be used afterwards.
+func (d *Database) Close() error {
+	instanceMu.Lock()
+	defer instanceMu.Unlock()
+
+	if dbInstance == d.store {
+		dbInstance = nil
+	}
+	close(d.done)
+	forget(d.store)
+
+	err := d.store.Close()
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("db: close %s: %v", d.path, err)
 	}
-	dbInstance = db
+	return nil
 }
 
+func instance() (Store, error) {
+	instanceMu.RLock()
+	defer instanceMu.RUnlock()
+
+	if dbInstance == nil {
+		return nil, ErrNotOpen
+	}
+	return dbInstance, nil
+}
+
+// DB is a namespace of a store, whose keys don't collide with those of the
+// other namespaces.
 type DB struct {
 	namespace []byte
+	store     Store
 }
 
+// New returns the namespace in the default store.
 func New(namespace string) *DB {
-	hash := sha256.Sum256([]byte(namespace))
+	return NewWithStore(nil, namespace)
+}
+
+// NewWithStore returns the namespace in store, or in the default store if
+// it's nil.
+func NewWithStore(store Store, namespace string) *DB {
+	hash := hashNamespace(namespace)
+	addName(hash, namespace)
 	return &DB{
-		namespace: hash[:],
+		namespace: hash,
+		store:     store,
 	}
 }
 
+func hashNamespace(namespace string) []byte {
+	hash := sha256.Sum256([]byte(namespace))
+	return hash[:]
+}
+
 func (db *DB) key(key []byte) []byte {
-	return append(db.namespace, key...)
+	return append(db.namespace[:len(db.namespace):len(db.namespace)], key...)
 }
 
-func (db *DB) Get(key []byte) ([]byte, error) {
-	value, err := dbInstance.Get(db.key(key), nil)
-	if err == nil {
-		return value, nil
+func (db *DB) getStore() (Store, error) {
+	if db.store != nil {
+		return db.store, nil
 	}
+	return instance()
+}
 
-	if err == leveldb.ErrNotFound {
-		return nil, nil
+func (db *DB) get(r Reader, key []byte) ([]byte, error) {
+	k := db.key(key)
+	value, err := r.Get(k)
+	if err != nil || value == nil {
+		return nil, err
 	}
 
-	return nil, err
+	exp, err := expired(r, k, time.Now())
+	if err != nil || exp {
+		return nil, err
+	}
+	return unseal(k, value)
+}
+
+func (db *DB) has(r Reader, key []byte) (bool, error) {
+	k := db.key(key)
+	ok, err := r.Has(k)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	exp, err := expired(r, k, time.Now())
+	return !exp, err
+}
+
+func (db *DB) iterate(r Reader, prefix []byte, f func(key, value []byte) bool) error {
+	now := time.Now()
+	var err error
+	iterErr := r.Iterate(db.key(prefix), func(key, value []byte) bool {
+		var exp bool
+		exp, err = expired(r, key, now)
+		if err != nil || exp {
+			return err == nil
+		}
+
+		value, err = unseal(key, value)
+		if err != nil {
+			return false
+		}
+		return f(key[len(db.namespace):], value)
+	})
+	if iterErr != nil {
+		return iterErr
+	}
+	return err
+}
+
+// Get returns the value of key, or nil if it doesn't exist.
+func (db *DB) Get(key []byte) ([]byte, error) {
+	store, err := db.getStore()
+	if err != nil {
+		return nil, err
+	}
+	return db.get(store, key)
+}
+
+// Has reports whether key exists.
+func (db *DB) Has(key []byte) (bool, error) {
+	store, err := db.getStore()
+	if err != nil {
+		return false, err
+	}
+	return db.has(store, key)
 }
 
 func (db *DB) Set(key, value []byte) error {
-	return dbInstance.Put(db.key(key), value, nil)
+	store, err := db.getStore()
+	if err != nil {
+		return err
+	}
+	k := db.key(key)
+	return db.write(store, []Op{
+		{Key: k, Value: value},
+		{Key: expiresKey(k), Delete: true},
+	})
+}
+
+func (db *DB) Delete(key []byte) error {
+	store, err := db.getStore()
+	if err != nil {
+		return err
+	}
+	k := db.key(key)
+	return db.write(store, []Op{
+		{Key: k, Delete: true},
+		{Key: expiresKey(k), Delete: true},
+	})
+}
+
+// Iterate calls f with the keys starting with prefix and their values, in
+// key order, until it returns false.
+func (db *DB) Iterate(prefix []byte, f func(key, value []byte) bool) error {
+	store, err := db.getStore()
+	if err != nil {
+		return err
+	}
+	return db.iterate(store, prefix, f)
+}
+
+// Keys returns the keys starting with prefix, in order.
+func (db *DB) Keys(prefix []byte) ([][]byte, error) {
+	var keys [][]byte
+	err := db.Iterate(prefix, func(key, _ []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys, err
+}
+
+// Batch collects writes to a namespace, applied atomically by Write.
+type Batch struct {
+	db    *DB
+	ops   []Op
+	count int
+}
+
+// NewBatch returns an empty batch of writes to db.
+func (db *DB) NewBatch() *Batch {
+	return &Batch{db: db}
+}
+
+func (b *Batch) Set(key, value []byte) {
+	k := b.db.key(key)
+	b.ops = append(b.ops, Op{Key: k, Value: value}, Op{Key: expiresKey(k), Delete: true})
+	b.count++
+}
+
+// SetWithTTL sets key to value until ttl elapses.
+func (b *Batch) SetWithTTL(key, value []byte, ttl time.Duration) {
+	k := b.db.key(key)
+	b.ops = append(b.ops, Op{Key: k, Value: value})
+	b.ops = append(b.ops, ttlOps(k, time.Now().Add(ttl))...)
+	b.count++
+}
+
+func (b *Batch) Delete(key []byte) {
+	k := b.db.key(key)
+	b.ops = append(b.ops, Op{Key: k, Delete: true}, Op{Key: expiresKey(k), Delete: true})
+	b.count++
+}
+
+// Len returns how many writes the batch holds.
+func (b *Batch) Len() int {
+	return b.count
+}
+
+// Write applies all the writes of the batch, or none of them.
+func (b *Batch) Write() error {
+	store, err := b.db.getStore()
+	if err != nil {
+		return err
+	}
+	return b.db.write(store, b.ops)
+}
+
+// Snapshot is a consistent read-only view of a namespace.
+type Snapshot struct {
+	db   *DB
+	snap StoreSnapshot
+}
+
+// Snapshot returns a view of db as of now, to be released after use.
+func (db *DB) Snapshot() (*Snapshot, error) {
+	store, err := db.getStore()
+	if err != nil {
+		return nil, err
+	}
+
+	snap, err := store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{db: db, snap: snap}, nil
+}
+
+func (s *Snapshot) Get(key []byte) ([]byte, error) {
+	return s.db.get(s.snap, key)
+}
+
+func (s *Snapshot) Has(key []byte) (bool, error) {
+	return s.db.has(s.snap, key)
+}
+
+func (s *Snapshot) Iterate(prefix []byte, f func(key, value []byte) bool) error {
+	return s.db.iterate(s.snap, prefix, f)
+}
+
+// Release releases the snapshot, it can't be used afterwards.
+func (s *Snapshot) Release() {
+	s.snap.Release()
 }
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	namespaceSize = 32
+
+	// importBatchSize is how many records are imported per atomic write.
+	importBatchSize = 1000
+)
+
+// Record is a key of an exported database, a line of the export file.
+type Record struct {
+	// Namespace is the hex encoded hash of the namespace name.
+	Namespace string `json:"namespace"`
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+
+	// TTL is how long the key had left to live when exported, empty if it
+	// doesn't expire.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// Export writes the keys of all the namespaces of r to w as JSON lines,
+// returning how many were written.
+func Export(r Reader, w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	now := time.Now()
+
+	var count int
+	var err error
+	iterErr := r.Iterate(nil, func(key, value []byte) bool {
+		if len(key) < namespaceSize || bytes.HasPrefix(key, ttlDB.namespace) {
+			return true
+		}
+
+		rec := Record{
+			Namespace: hex.EncodeToString(key[:namespaceSize]),
+			Key:       key[namespaceSize:],
+			Value:     value,
+		}
+
+		var expires time.Time
+		var ok bool
+		expires, ok, err = expiration(r, key)
+		if err != nil {
+			return false
+		}
+
+		if ok {
+			if !now.Before(expires) {
+				return true
+			}
+			rec.TTL = expires.Sub(now).String()
+		}
+
+		err = enc.Encode(&rec)
+		if err != nil {
+			return false
+		}
+		count++
+		return true
+	})
+	if iterErr != nil {
+		return count, iterErr
+	}
+	if err != nil {
+		return count, err
+	}
+	return count, bw.Flush()
+}
+
+// Import writes the keys exported to r into store, replacing the existing
+// ones, and returns how many were imported.
+func Import(store Store, r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	now := time.Now()
+
+	var ops []Op
+	var count int
+	for {
+		var rec Record
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("record %d: %v", count+1, err)
+		}
+
+		namespace, err := hex.DecodeString(rec.Namespace)
+		if err != nil || len(namespace) != namespaceSize {
+			return count, fmt.Errorf("record %d: invalid namespace %s", count+1, rec.Namespace)
+		}
+
+		key := append(namespace, rec.Key...)
+		ops = append(ops, Op{Key: key, Value: rec.Value}, Op{Key: expiresKey(key), Delete: true})
+		if len(rec.TTL) > 0 {
+			ttl, err := time.ParseDuration(rec.TTL)
+			if err != nil {
+				return count, fmt.Errorf("record %d: %v", count+1, err)
+			}
+			ops = append(ops, ttlOps(key, now.Add(ttl))...)
+		}
+		count++
+
+		if count%importBatchSize == 0 {
+			err = store.Write(ops)
+			if err != nil {
+				return count - importBatchSize, err
+			}
+			ops = nil
+		}
+	}
+
+	if len(ops) == 0 {
+		return count, nil
+	}
+
+	err := store.Write(ops)
+	if err != nil {
+		return count - count%importBatchSize, err
+	}
+	return count, nil
+}
+
+// Export writes a consistent snapshot of the database to w, see Export.
+func (d *Database) Export(w io.Writer) (int, error) {
+	snap, err := d.store.Snapshot()
+	if err != nil {
+		return 0, err
+	}
+	defer snap.Release()
+
+	return Export(snap, w)
+}
+
+// Backup exports the database to the file at path while it's in use. The
+// file is only replaced once the export is complete.
+func (d *Database) Backup(path string) (int, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+
+	count, err := d.Export(f)
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return 0, err
+	}
+	return count, os.Rename(f.Name(), path)
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// reader is implemented by both leveldb databases and snapshots.
+type reader interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	Has(key []byte, ro *opt.ReadOptions) (bool, error)
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+}
+
+type levelReader struct {
+	r reader
+}
+
+func (l levelReader) Get(key []byte) ([]byte, error) {
+	value, err := l.r.Get(key, nil)
+	if err == nil {
+		return value, nil
+	}
+
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+
+	return nil, err
+}
+
+func (l levelReader) Has(key []byte) (bool, error) {
+	return l.r.Has(key, nil)
+}
+
+func (l levelReader) Iterate(prefix []byte, f func(key, value []byte) bool) error {
+	iter := l.r.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		key := append([]byte(nil), iter.Key()...)
+		value := append([]byte(nil), iter.Value()...)
+		if !f(key, value) {
+			break
+		}
+	}
+	return iter.Error()
+}
+
+type levelStore struct {
+	levelReader
+	ldb *leveldb.DB
+}
+
+// OpenLevelDB opens the leveldb database at path, creating it unless
+// read-only.
+func OpenLevelDB(path string, o *Options) (Store, error) {
+	if o == nil {
+		o = &Options{}
+	}
+
+	ldb, err := leveldb.OpenFile(path, &opt.Options{
+		BlockCacheCapacity: o.CacheSize,
+		WriteBuffer:        o.WriteBufferSize,
+		ReadOnly:           o.ReadOnly,
+		ErrorIfMissing:     o.ReadOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &levelStore{
+		levelReader: levelReader{ldb},
+		ldb:         ldb,
+	}, nil
+}
+
+func (s *levelStore) Put(key, value []byte) error {
+	return s.ldb.Put(key, value, nil)
+}
+
+func (s *levelStore) Delete(key []byte) error {
+	return s.ldb.Delete(key, nil)
+}
+
+func (s *levelStore) Write(ops []Op) error {
+	var batch leveldb.Batch
+	for _, op := range ops {
+		if op.Delete {
+			batch.Delete(op.Key)
+		} else {
+			batch.Put(op.Key, op.Value)
+		}
+	}
+	return s.ldb.Write(&batch, nil)
+}
+
+type levelSnapshot struct {
+	levelReader
+	snap *leveldb.Snapshot
+}
+
+func (s *levelStore) Snapshot() (StoreSnapshot, error) {
+	snap, err := s.ldb.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &levelSnapshot{
+		levelReader: levelReader{snap},
+		snap:        snap,
+	}, nil
+}
+
+func (s *levelSnapshot) Release() {
+	s.snap.Release()
+}
+
+func (s *levelStore) Close() error {
+	return s.ldb.Close()
+}
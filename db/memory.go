@@ -0,0 +1,121 @@
+package db
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+type memReader struct {
+	mu     *sync.RWMutex
+	values map[string][]byte
+}
+
+func (m memReader) Get(key []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	value, ok := m.values[string(key)]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (m memReader) Has(key []byte) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.values[string(key)]
+	return ok, nil
+}
+
+// Iterate doesn't hold the lock while calling f, which may write the store.
+func (m memReader) Iterate(prefix []byte, f func(key, value []byte) bool) error {
+	m.mu.RLock()
+	var keys []string
+	for key := range m.values {
+		if strings.HasPrefix(key, string(prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		m.mu.RLock()
+		value, ok := m.values[key]
+		m.mu.RUnlock()
+
+		if ok && !f([]byte(key), append([]byte{}, value...)) {
+			break
+		}
+	}
+	return nil
+}
+
+type memStore struct {
+	memReader
+}
+
+// NewMemory returns a store keeping its keys in memory, lost on exit.
+func NewMemory() Store {
+	return &memStore{memReader{
+		mu:     &sync.RWMutex{},
+		values: make(map[string][]byte),
+	}}
+}
+
+func (s *memStore) Put(key, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (s *memStore) Delete(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.values, string(key))
+	return nil
+}
+
+func (s *memStore) Write(ops []Op) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, op := range ops {
+		if op.Delete {
+			delete(s.values, string(op.Key))
+		} else {
+			s.values[string(op.Key)] = append([]byte{}, op.Value...)
+		}
+	}
+	return nil
+}
+
+type memSnapshot struct {
+	memReader
+}
+
+func (s *memStore) Snapshot() (StoreSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	values := make(map[string][]byte, len(s.values))
+	for key, value := range s.values {
+		values[key] = value
+	}
+	return memSnapshot{memReader{
+		mu:     &sync.RWMutex{},
+		values: values,
+	}}, nil
+}
+
+func (memSnapshot) Release() {}
+
+func (s *memStore) Close() error {
+	return nil
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Migration upgrades the data of a namespace to Version.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(tx *Tx) error
+}
+
+// MigrationResult describes the migrations of a namespace.
+type MigrationResult struct {
+	Namespace string
+	From      int
+	To        int
+	// Writes is how many keys the migrations set or deleted.
+	Writes int
+}
+
+var (
+	// versionsDB maps the hashes of the namespaces to their schema version.
+	versionsDB = New("\x00versions")
+
+	migrationsMu sync.Mutex
+	migrations   = make(map[string][]Migration)
+)
+
+// RegisterMigration registers a migration of the namespace, which should be
+// done in the init func of the plugin. The migrations of a namespace run
+// in the order of their versions.
+func RegisterMigration(namespace string, m Migration) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+
+	for _, other := range migrations[namespace] {
+		if other.Version == m.Version {
+			panic(fmt.Sprintf("db: migration %d of %s registered twice", m.Version, namespace))
+		}
+	}
+
+	ms := append(migrations[namespace], m)
+	sort.Slice(ms, func(i, j int) bool {
+		return ms[i].Version < ms[j].Version
+	})
+	migrations[namespace] = ms
+}
+
+// Version returns the schema version of the namespace, zero if it was never
+// migrated.
+func (db *DB) Version() (int, error) {
+	store, err := db.getStore()
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := store.Get(versionsDB.key(db.namespace))
+	if err != nil || data == nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(data))
+}
+
+// Migrate runs the pending migrations of each namespace of store, all of a
+// namespace in a single transaction. With dryRun, nothing is written and
+// the results tell what would be.
+func Migrate(store Store, dryRun bool) ([]*MigrationResult, error) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+
+	var namespaces []string
+	for namespace := range migrations {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	var results []*MigrationResult
+	for _, namespace := range namespaces {
+		result, err := migrate(NewWithStore(store, namespace), migrations[namespace], dryRun)
+		if err != nil {
+			return results, fmt.Errorf("db: migrate %s: %v", namespace, err)
+		}
+
+		if result != nil {
+			result.Namespace = namespace
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+func migrate(db *DB, ms []Migration, dryRun bool) (*MigrationResult, error) {
+	from, err := db.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.snap.Release()
+
+	result := &MigrationResult{From: from, To: from}
+	for _, m := range ms {
+		if m.Version <= from {
+			continue
+		}
+
+		err = m.Up(tx)
+		if err != nil {
+			return nil, fmt.Errorf("version %d: %v", m.Version, err)
+		}
+		result.To = m.Version
+	}
+
+	if result.To == from {
+		return nil, nil
+	}
+
+	result.Writes = len(tx.pending)
+	if dryRun {
+		return result, nil
+	}
+	return result, tx.commit(result.To)
+}
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// NamespaceStats describes a namespace of a store.
+type NamespaceStats struct {
+	Hash string
+	Name string
+	Keys int
+	// Bytes is the size of the keys and values.
+	Bytes int64
+}
+
+var (
+	// registryDB maps the hashes of the namespaces written to their names.
+	registryDB = New("\x00namespaces")
+
+	// writeMu serializes the writes, for the sweeper to delete the expired
+	// keys only if they weren't set again meanwhile.
+	writeMu sync.Mutex
+
+	namesMu sync.Mutex
+	// names maps the hashes of the namespaces created by this process to
+	// their names, and tells whether they're registered in a store.
+	names      = make(map[string]string)
+	registered = make(map[Store]map[string]bool)
+)
+
+func addName(hash []byte, name string) {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	names[string(hash)] = name
+}
+
+// write applies ops to store, registering the namespace along the first
+// time, and notifies the subscribers of the namespace.
+func (db *DB) write(store Store, ops []Op) error {
+	plain := ops
+	ops, err := db.sealOps(ops)
+	if err != nil {
+		return err
+	}
+
+	hash := string(db.namespace)
+
+	namesMu.Lock()
+	name, known := names[hash]
+	known = known && !registered[store][hash]
+	namesMu.Unlock()
+
+	if known {
+		ops = append(ops, Op{Key: registryDB.key(db.namespace), Value: []byte(name)})
+	}
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+
+	err = store.Write(ops)
+	if err != nil {
+		return err
+	}
+
+	if known {
+		namesMu.Lock()
+		if registered[store] == nil {
+			registered[store] = make(map[string]bool)
+		}
+		registered[store][hash] = true
+		namesMu.Unlock()
+	}
+
+	db.notify(plain)
+	return nil
+}
+
+// forget drops what's known of store, once closed.
+func forget(store Store) {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	delete(registered, store)
+}
+
+// Names returns the names of the namespaces by hex encoded hash, both those
+// registered in r and those created by this process.
+func Names(r Reader) (map[string]string, error) {
+	m := make(map[string]string)
+	err := r.Iterate(registryDB.key(nil), func(key, value []byte) bool {
+		m[hex.EncodeToString(key[namespaceSize:])] = string(value)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	for hash, name := range names {
+		m[hex.EncodeToString([]byte(hash))] = name
+	}
+	return m, nil
+}
+
+// Namespace returns the namespace of store named ns, or whose hash is the
+// hex string ns, looking it up without registering it.
+func Namespace(store Store, ns string) (*DB, error) {
+	names, err := Names(store)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := hashNamespace(ns)
+	if name, ok := names[hex.EncodeToString(hash)]; ok && name == ns {
+		return &DB{namespace: hash, store: store}, nil
+	}
+
+	hash, err = hex.DecodeString(ns)
+	if err == nil && len(hash) == namespaceSize {
+		_, ok := names[hex.EncodeToString(hash)]
+		if !ok {
+			// the namespaces written before the registry have no name.
+			err = store.Iterate(hash, func(_, _ []byte) bool {
+				ok = true
+				return false
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if ok {
+			return &DB{namespace: hash, store: store}, nil
+		}
+	}
+	return nil, fmt.Errorf("db: unknown namespace %s", ns)
+}
+
+// Stats returns the stats of the namespaces of r, sorted by name.
+func Stats(r Reader) ([]*NamespaceStats, error) {
+	names, err := Names(r)
+	if err != nil {
+		return nil, err
+	}
+
+	byHash := make(map[string]*NamespaceStats)
+	err = r.Iterate(nil, func(key, value []byte) bool {
+		if len(key) < namespaceSize {
+			return true
+		}
+
+		hash := hex.EncodeToString(key[:namespaceSize])
+		s, ok := byHash[hash]
+		if !ok {
+			s = &NamespaceStats{Hash: hash, Name: names[hash]}
+			byHash[hash] = s
+		}
+		s.Keys++
+		s.Bytes += int64(len(key) + len(value))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []*NamespaceStats
+	for _, s := range byHash {
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Name != stats[j].Name {
+			return stats[i].Name < stats[j].Name
+		}
+		return stats[i].Hash < stats[j].Hash
+	})
+	return stats, nil
+}
+
+// Clear deletes all the keys of the namespace, returning how many.
+func (db *DB) Clear() (int, error) {
+	keys, err := db.Keys(nil)
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+
+	b := db.NewBatch()
+	for _, key := range keys {
+		b.Delete(key)
+	}
+	return len(keys), b.Write()
+}
@@ -0,0 +1,41 @@
+package db
+
+// Reader reads keys of a store.
+type Reader interface {
+	// Get returns the value of key, or nil if it doesn't exist.
+	Get(key []byte) ([]byte, error)
+	Has(key []byte) (bool, error)
+
+	// Iterate calls f with the keys starting with prefix and their values,
+	// in key order, until it returns false. f owns the slices it's given.
+	Iterate(prefix []byte, f func(key, value []byte) bool) error
+}
+
+// Op is a write of a batch, deleting the key if Delete is set.
+type Op struct {
+	Key    []byte
+	Value  []byte
+	Delete bool
+}
+
+// Store is a storage backend of the namespaces.
+type Store interface {
+	Reader
+
+	Put(key, value []byte) error
+	Delete(key []byte) error
+
+	// Write applies all the ops, or none of them.
+	Write(ops []Op) error
+
+	// Snapshot returns a consistent view of the store as of now.
+	Snapshot() (StoreSnapshot, error)
+
+	Close() error
+}
+
+// StoreSnapshot is a read-only view of a store, to be released after use.
+type StoreSnapshot interface {
+	Reader
+	Release()
+}
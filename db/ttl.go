@@ -0,0 +1,152 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultSweepInterval is how often the expired keys are deleted unless
+	// configured otherwise.
+	DefaultSweepInterval = time.Minute
+
+	expiresPart = "expires"
+	duePart     = "due"
+)
+
+// ttlDB prefixes the expiration times of the keys of all the namespaces,
+// which are stored twice: by key, checked when reading it, and by time,
+// swept by the janitor.
+var ttlDB = New("\x00ttl")
+
+func expiresKey(key []byte) []byte {
+	return ttlDB.key(Key(expiresPart, string(key)))
+}
+
+func dueKey(expires int64, key []byte) []byte {
+	return ttlDB.key(Key(duePart, fmt.Sprintf("%020d", expires), string(key)))
+}
+
+// expiration returns when the key, with its namespace, expires, if ever.
+func expiration(r Reader, key []byte) (time.Time, bool, error) {
+	data, err := r.Get(expiresKey(key))
+	if err != nil || data == nil {
+		return time.Time{}, false, err
+	}
+
+	expires, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return time.Unix(0, expires), true, nil
+}
+
+// expired reports whether the key, with its namespace, expired by now.
+func expired(r Reader, key []byte, now time.Time) (bool, error) {
+	expires, ok, err := expiration(r, key)
+	return ok && !now.Before(expires), err
+}
+
+func ttlOps(key []byte, expires time.Time) []Op {
+	t := expires.UnixNano()
+	return []Op{
+		{Key: expiresKey(key), Value: []byte(strconv.FormatInt(t, 10))},
+		{Key: dueKey(t, key)},
+	}
+}
+
+// SetWithTTL sets key to value until ttl elapses, when it's deleted. Setting
+// it again without a ttl makes it persistent.
+func (db *DB) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	store, err := db.getStore()
+	if err != nil {
+		return err
+	}
+
+	k := db.key(key)
+	ops := append([]Op{{Key: k, Value: value}}, ttlOps(k, time.Now().Add(ttl))...)
+	return db.write(store, ops)
+}
+
+// Sweep deletes the keys of store which expired by now, returning how many.
+// The subscribers of their namespaces are notified of the deletions.
+func Sweep(store Store, now time.Time) (int, error) {
+	type due struct {
+		key     []byte
+		expires string
+		dueKey  []byte
+	}
+
+	var dues []due
+	err := store.Iterate(ttlDB.key(KeyPrefix(duePart)), func(key, _ []byte) bool {
+		parts := SplitKey(key[len(ttlDB.namespace):])
+		if len(parts) != 3 {
+			return true
+		}
+
+		t, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return true
+		}
+
+		if t > now.UnixNano() {
+			return false
+		}
+
+		dues = append(dues, due{[]byte(parts[2]), strconv.FormatInt(t, 10), key})
+		return true
+	})
+	if err != nil || len(dues) == 0 {
+		return 0, err
+	}
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+
+	// The due key outlives the expiration replaced by a later Set, checked
+	// along with the deletion not to delete the value set meanwhile.
+	var ops, deleted []Op
+	for _, d := range dues {
+		data, err := store.Get(expiresKey(d.key))
+		if err != nil {
+			return 0, err
+		}
+
+		if string(data) == d.expires {
+			ops = append(ops, Op{Key: d.key, Delete: true}, Op{Key: expiresKey(d.key), Delete: true})
+			deleted = append(deleted, Op{Key: d.key, Delete: true})
+		}
+		ops = append(ops, Op{Key: d.dueKey, Delete: true})
+	}
+
+	err = store.Write(ops)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, op := range deleted {
+		if len(op.Key) >= namespaceSize {
+			(&DB{namespace: op.Key[:namespaceSize]}).notify([]Op{op})
+		}
+	}
+	return len(deleted), nil
+}
+
+func (d *Database) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			_, err := Sweep(d.store, now)
+			if err != nil {
+				log.Println("db", err)
+			}
+		case <-d.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+)
+
+// Tx is a transaction of a namespace, whose writes are only applied, all at
+// once, when it's committed. Its reads see its own writes over a snapshot
+// taken when it began.
+type Tx struct {
+	db      *DB
+	store   Store
+	snap    StoreSnapshot
+	pending map[string]*Op
+}
+
+func (db *DB) begin() (*Tx, error) {
+	store, err := db.getStore()
+	if err != nil {
+		return nil, err
+	}
+
+	snap, err := store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{
+		db:      db,
+		store:   store,
+		snap:    snap,
+		pending: make(map[string]*Op),
+	}, nil
+}
+
+func (tx *Tx) Get(key []byte) ([]byte, error) {
+	if op, ok := tx.pending[string(key)]; ok {
+		if op.Delete {
+			return nil, nil
+		}
+		return op.Value, nil
+	}
+	return tx.db.get(tx.snap, key)
+}
+
+func (tx *Tx) Has(key []byte) (bool, error) {
+	if op, ok := tx.pending[string(key)]; ok {
+		return !op.Delete, nil
+	}
+	return tx.db.has(tx.snap, key)
+}
+
+func (tx *Tx) Set(key, value []byte) {
+	tx.pending[string(key)] = &Op{Key: key, Value: value}
+}
+
+func (tx *Tx) Delete(key []byte) {
+	tx.pending[string(key)] = &Op{Key: key, Delete: true}
+}
+
+// Iterate calls f with the keys starting with prefix and their values, in
+// key order, until it returns false.
+func (tx *Tx) Iterate(prefix []byte, f func(key, value []byte) bool) error {
+	values := make(map[string][]byte)
+	err := tx.db.iterate(tx.snap, prefix, func(key, value []byte) bool {
+		values[string(key)] = value
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, op := range tx.pending {
+		if !bytes.HasPrefix(op.Key, prefix) {
+			continue
+		}
+
+		if op.Delete {
+			delete(values, key)
+		} else {
+			values[key] = op.Value
+		}
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !f([]byte(key), values[key]) {
+			break
+		}
+	}
+	return nil
+}
+
+// commit applies the writes of the transaction along with the new schema
+// version of the namespace.
+func (tx *Tx) commit(version int) error {
+	var ops []Op
+	for _, op := range tx.pending {
+		k := tx.db.key(op.Key)
+		ops = append(ops, Op{Key: k, Value: op.Value, Delete: op.Delete}, Op{Key: expiresKey(k), Delete: true})
+	}
+
+	ops = append(ops, Op{
+		Key:   versionsDB.key(tx.db.namespace),
+		Value: []byte(strconv.Itoa(version)),
+	})
+	return tx.db.write(tx.store, ops)
+}
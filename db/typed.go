@@ -0,0 +1,98 @@
+package db
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const keySeparator = "\x00"
+
+var (
+	escaper   = strings.NewReplacer("\x01", "\x01\x02", "\x00", "\x01\x01")
+	unescaper = strings.NewReplacer("\x01\x02", "\x01", "\x01\x01", "\x00")
+
+	// incrMu makes the increments atomic.
+	incrMu sync.Mutex
+)
+
+// Key returns the composite key made of parts, which are escaped so that
+// keys of different parts never collide.
+func Key(parts ...string) []byte {
+	escaped := make([]string, len(parts))
+	for i, part := range parts {
+		escaped[i] = escaper.Replace(part)
+	}
+	return []byte(strings.Join(escaped, keySeparator))
+}
+
+// KeyPrefix returns the prefix of the composite keys starting with parts.
+func KeyPrefix(parts ...string) []byte {
+	return append(Key(parts...), keySeparator...)
+}
+
+// SplitKey returns the parts of a composite key.
+func SplitKey(key []byte) []string {
+	parts := strings.Split(string(key), keySeparator)
+	for i, part := range parts {
+		parts[i] = unescaper.Replace(part)
+	}
+	return parts
+}
+
+// GetJSON decodes the value of key into v, reporting whether it exists.
+func (db *DB) GetJSON(key []byte, v interface{}) (bool, error) {
+	data, err := db.Get(key)
+	if err != nil || data == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// SetJSON sets key to the JSON encoding of v.
+func (db *DB) SetJSON(key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return db.Set(key, data)
+}
+
+// SetJSON sets key to the JSON encoding of v.
+func (b *Batch) SetJSON(key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b.Set(key, data)
+	return nil
+}
+
+// GetInt returns the integer value of key, zero if it doesn't exist.
+func (db *DB) GetInt(key []byte) (int64, error) {
+	data, err := db.Get(key)
+	if err != nil || len(data) == 0 {
+		return 0, err
+	}
+	return strconv.ParseInt(string(data), 10, 64)
+}
+
+func (db *DB) SetInt(key []byte, v int64) error {
+	return db.Set(key, []byte(strconv.FormatInt(v, 10)))
+}
+
+// Incr adds delta to the integer value of key and returns the sum. It's
+// atomic with respect to the other increments.
+func (db *DB) Incr(key []byte, delta int64) (int64, error) {
+	incrMu.Lock()
+	defer incrMu.Unlock()
+
+	v, err := db.GetInt(key)
+	if err != nil {
+		return 0, err
+	}
+
+	v += delta
+	return v, db.SetInt(key, v)
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Change is a write to a key of a namespace.
+type Change struct {
+	Key     []byte
+	Value   []byte
+	Deleted bool
+}
+
+type subscriber struct {
+	f func(Change)
+}
+
+var (
+	subscribersMu sync.RWMutex
+	subscribers   = make(map[string][]*subscriber)
+)
+
+// Subscribe calls f after each write to the keys of the namespace, in any
+// store, until unsubscribed. f is called by the writer so it shouldn't
+// block.
+func (db *DB) Subscribe(f func(Change)) (unsubscribe func()) {
+	s := &subscriber{f}
+	hash := string(db.namespace)
+
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	subscribers[hash] = append(subscribers[hash], s)
+
+	return func() {
+		subscribersMu.Lock()
+		defer subscribersMu.Unlock()
+
+		subs := subscribers[hash]
+		for i, other := range subs {
+			if other == s {
+				subscribers[hash] = append(subs[:i:i], subs[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// notify calls the subscribers of the namespace with the changes of the
+// keys of ops.
+func (db *DB) notify(ops []Op) {
+	subscribersMu.RLock()
+	subs := subscribers[string(db.namespace)]
+	subscribersMu.RUnlock()
+
+	if len(subs) == 0 {
+		return
+	}
+
+	for _, op := range ops {
+		if !bytes.HasPrefix(op.Key, db.namespace) {
+			continue
+		}
+
+		c := Change{
+			Key:     op.Key[len(db.namespace):],
+			Value:   op.Value,
+			Deleted: op.Delete,
+		}
+		for _, s := range subs {
+			s.f(c)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package plugins
+
+import (
+	"sync"
+
+	"github.com/go-chat-bot/bot"
+)
+
+// PermissionDenied is the message replied to non-admins running admin commands.
+const PermissionDenied = "Permission denied"
+
+var (
+	adminsMu sync.RWMutex
+	admins   = make(map[string]bool)
+)
+
+// SetAdmins sets the IDs of the users allowed to run admin commands.
+func SetAdmins(ids []string) {
+	adminsMu.Lock()
+	defer adminsMu.Unlock()
+
+	admins = make(map[string]bool)
+	for _, id := range ids {
+		admins[id] = true
+	}
+}
+
+// IsAdmin reports whether user may run admin commands.
+func IsAdmin(user *bot.User) bool {
+	if user == nil {
+		return false
+	}
+
+	adminsMu.RLock()
+	defer adminsMu.RUnlock()
+	return admins[user.ID]
+}
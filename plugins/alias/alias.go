@@ -0,0 +1,185 @@
+package alias
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-chat-bot/bot"
+	"github.com/tidyoux/chatbot/db"
+	"github.com/tidyoux/chatbot/plugins"
+)
+
+const (
+	namespace = "alias"
+
+	chatScope = "chat"
+	userScope = "user"
+	userFlag  = "-u"
+
+	success       = "status:ok"
+	aliasNotFound = "alias %s not found"
+	noAliases     = "no aliases"
+)
+
+var (
+	dbInstance = db.New(namespace)
+
+	// mu serializes the read-modify-write of a scope's alias table.
+	mu sync.Mutex
+
+	// reservedNames are the built-in commands of the bot, besides those
+	// registered through plugins.
+	reservedNames = map[string]bool{"help": true}
+)
+
+func scopeKey(scope, id string) []byte {
+	return db.Key(scope, id)
+}
+
+func load(scope, id string) (map[string]string, error) {
+	aliases := make(map[string]string)
+	_, err := dbInstance.GetJSON(scopeKey(scope, id), &aliases)
+	if err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+func save(scope, id string, aliases map[string]string) error {
+	return dbInstance.SetJSON(scopeKey(scope, id), aliases)
+}
+
+// rawTail returns raw without its first n space separated fields,
+// keeping the quoting of the remaining text intact.
+func rawTail(raw string, n int) string {
+	raw = strings.TrimSpace(raw)
+	for i := 0; i < n; i++ {
+		k := strings.IndexAny(raw, " \t")
+		if k < 0 {
+			return ""
+		}
+		raw = strings.TrimSpace(raw[k:])
+	}
+	return raw
+}
+
+func add(scope, id string, name, expansion string) (string, error) {
+	name = strings.TrimPrefix(name, bot.CmdPrefix)
+	expansion = strings.TrimPrefix(expansion, bot.CmdPrefix)
+	if len(name) == 0 || len(expansion) == 0 || reservedNames[name] || plugins.IsCommand(name) {
+		return plugins.InvalidParams, nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	aliases, err := load(scope, id)
+	if err != nil {
+		return "", err
+	}
+
+	aliases[name] = expansion
+	err = save(scope, id, aliases)
+	if err != nil {
+		return "", err
+	}
+	return success, nil
+}
+
+func remove(scope, id string, name string) (string, error) {
+	name = strings.TrimPrefix(name, bot.CmdPrefix)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	aliases, err := load(scope, id)
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := aliases[name]; !ok {
+		return fmt.Sprintf(aliasNotFound, name), nil
+	}
+
+	delete(aliases, name)
+	err = save(scope, id, aliases)
+	if err != nil {
+		return "", err
+	}
+	return success, nil
+}
+
+func list(channel, userID string) (string, error) {
+	var lines []string
+	for _, s := range []struct{ scope, id string }{{chatScope, channel}, {userScope, userID}} {
+		aliases, err := load(s.scope, s.id)
+		if err != nil {
+			return "", err
+		}
+
+		if len(aliases) == 0 {
+			continue
+		}
+
+		var names []string
+		for name := range aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		lines = append(lines, s.scope+" aliases:")
+		for _, name := range names {
+			lines = append(lines, fmt.Sprintf("%s = %s", name, aliases[name]))
+		}
+	}
+
+	if len(lines) == 0 {
+		return noAliases, nil
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func alias(_ context.Context, command *bot.Cmd) (string, error) {
+	if len(command.Args) < 1 {
+		return plugins.InvalidAmountOfParams, nil
+	}
+
+	op := command.Args[0]
+	if op == "list" {
+		return list(command.Channel, command.User.ID)
+	}
+
+	skip := 1
+	scope, id := chatScope, command.Channel
+	if len(command.Args) > 1 && command.Args[1] == userFlag {
+		skip++
+		scope, id = userScope, command.User.ID
+	}
+
+	args := command.Args[skip:]
+	switch op {
+	case "add":
+		if len(args) < 2 {
+			return plugins.InvalidAmountOfParams, nil
+		}
+		return add(scope, id, args[0], rawTail(command.RawArgs, skip+1))
+	case "rm":
+		if len(args) != 1 {
+			return plugins.InvalidAmountOfParams, nil
+		}
+		return remove(scope, id, args[0])
+	default:
+		return plugins.InvalidParams, nil
+	}
+}
+
+func init() {
+	plugins.RegisterCommand(
+		"alias",
+		"Manages command aliases of the chat, or of yourself with -u. Placeholders $1-$9 and $@ take the alias arguments.",
+		"add [-u] w weather chaoyang,beijing (or, list, or, rm [-u] w)",
+		alias)
+}
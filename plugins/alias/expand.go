@@ -0,0 +1,110 @@
+package alias
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chat-bot/bot"
+	"github.com/mattn/go-shellwords"
+)
+
+const (
+	maxDepth = 8
+)
+
+var (
+	placeholder = regexp.MustCompile(`\$(@|[1-9])`)
+)
+
+func lookup(channel, userID string, name string) (string, bool, error) {
+	for _, s := range []struct{ scope, id string }{{userScope, userID}, {chatScope, channel}} {
+		aliases, err := load(s.scope, s.id)
+		if err != nil {
+			return "", false, err
+		}
+
+		if expansion, ok := aliases[name]; ok {
+			return expansion, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// quote quotes arg for the bot to parse it back as a single argument.
+func quote(arg string) string {
+	if len(arg) > 0 && !strings.ContainsAny(arg, " \t\n'\"\\`$|&;<>()") {
+		return arg
+	}
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+func substitute(expansion, rawArgs string) (string, error) {
+	args, err := shellwords.Parse(rawArgs)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing arguments: %v", err)
+	}
+
+	used := false
+	result := placeholder.ReplaceAllStringFunc(expansion, func(p string) string {
+		used = true
+		if p == "$@" {
+			return rawArgs
+		}
+
+		i, _ := strconv.Atoi(p[1:])
+		if i <= len(args) {
+			return quote(args[i-1])
+		}
+		return ""
+	})
+
+	if !used && len(rawArgs) > 0 {
+		result += " " + rawArgs
+	}
+	return bot.CmdPrefix + result, nil
+}
+
+// Expand rewrites a command message starting with an alias of the user or
+// of the chat into the command it stands for. Like shell aliases, a name
+// already expanded once is left as is.
+func Expand(channel, userID string, text string) (string, error) {
+	seen := make(map[string]bool)
+	for depth := 0; ; depth++ {
+		s := strings.TrimSpace(text)
+		if !strings.HasPrefix(s, bot.CmdPrefix) {
+			return text, nil
+		}
+
+		pieces := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(s, bot.CmdPrefix)), " ", 2)
+		name := pieces[0]
+		if len(name) == 0 || seen[name] {
+			return text, nil
+		}
+
+		expansion, ok, err := lookup(channel, userID, name)
+		if err != nil {
+			return "", err
+		}
+
+		if !ok {
+			return text, nil
+		}
+
+		if depth >= maxDepth {
+			return "", fmt.Errorf("alias %s nested too deep", name)
+		}
+		seen[name] = true
+
+		var rawArgs string
+		if len(pieces) > 1 {
+			rawArgs = strings.TrimSpace(pieces[1])
+		}
+
+		text, err = substitute(expansion, rawArgs)
+		if err != nil {
+			return "", err
+		}
+	}
+}
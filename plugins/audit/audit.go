@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chat-bot/bot"
+	"github.com/tidyoux/chatbot/plugins"
+)
+
+const (
+	redacted = "[redacted]"
+
+	defaultCount  = 10
+	maxCount      = 100
+	pruneInterval = time.Hour
+
+	noEntries = "no audit entries"
+)
+
+// Config controls what the audit log records and how long it keeps it.
+type Config struct {
+	// Redact lists commands whose arguments aren't recorded. A rule
+	// "command sub" only hides the arguments following sub.
+	Redact []string
+
+	// Retention is how long entries are kept, zero keeps them forever.
+	Retention time.Duration
+}
+
+// DefaultRedact lists the commands whose arguments may be secrets.
+var DefaultRedact = []string{"crypto", "encode", "decode", "db set"}
+
+var (
+	configMu    sync.RWMutex
+	redactRules = redactSet(DefaultRedact)
+	stopPrune   chan struct{}
+)
+
+// Configure applies cfg and (re)starts the pruning of expired entries.
+func Configure(cfg Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	redactRules = redactSet(cfg.Redact)
+
+	if stopPrune != nil {
+		close(stopPrune)
+		stopPrune = nil
+	}
+
+	if cfg.Retention > 0 {
+		stopPrune = make(chan struct{})
+		go pruneLoop(cfg.Retention, stopPrune)
+	}
+}
+
+func redactSet(rules []string) map[string]bool {
+	m := make(map[string]bool)
+	for _, rule := range rules {
+		m[strings.Join(strings.Fields(rule), " ")] = true
+	}
+	return m
+}
+
+func pruneLoop(retention time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		count, err := prune(time.Now().Add(-retention))
+		if err != nil {
+			log.Println(namespace, err)
+		} else if count > 0 {
+			log.Printf("%s: pruned %d entries\n", namespace, count)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func redact(cmd *bot.Cmd) string {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	if redactRules[cmd.Command] {
+		return redacted
+	}
+
+	if len(cmd.Args) > 0 && redactRules[cmd.Command+" "+cmd.Args[0]] {
+		return cmd.Args[0] + " " + redacted
+	}
+	return cmd.RawArgs
+}
+
+// Middleware returns the middleware recording executed commands.
+func Middleware() plugins.Middleware {
+	return plugins.Observe(record)
+}
+
+func record(inv *plugins.Invocation) {
+	e := &Entry{
+		Time:     inv.Start,
+		Channel:  inv.Cmd.Channel,
+		Command:  inv.Cmd.Command,
+		Args:     redact(inv.Cmd),
+		Outcome:  "ok",
+		Duration: inv.Duration,
+	}
+
+	if inv.Cmd.User != nil {
+		e.UserID = inv.Cmd.User.ID
+		e.UserNick = inv.Cmd.User.Nick
+	}
+
+	if inv.Err != nil {
+		e.Outcome = "error: " + inv.Err.Error()
+	}
+
+	err := appendEntry(e)
+	if err != nil {
+		log.Println(namespace, err)
+	}
+}
+
+func (e *Entry) String() string {
+	return fmt.Sprintf("%s chat=%s user=%s(%s) %s%s %s %s %v",
+		e.Time.Format("2006-01-02 15:04:05"), e.Channel, e.UserNick, e.UserID,
+		bot.CmdPrefix, e.Command, e.Args, e.Outcome, e.Duration.Round(time.Millisecond))
+}
+
+func audit(_ context.Context, command *bot.Cmd) (string, error) {
+	if !plugins.IsAdmin(command.User) {
+		return plugins.PermissionDenied, nil
+	}
+
+	var user, cmd string
+	count := defaultCount
+	args := command.Args
+	for len(args) > 0 {
+		switch {
+		case args[0] == "user" && len(args) > 1:
+			user = args[1]
+			args = args[2:]
+		case args[0] == "cmd" && len(args) > 1:
+			cmd = strings.TrimPrefix(args[1], bot.CmdPrefix)
+			args = args[2:]
+		default:
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return plugins.InvalidParams, nil
+			}
+			count = n
+			args = args[1:]
+		}
+	}
+
+	if count > maxCount {
+		count = maxCount
+	}
+
+	entries, err := recent(count, func(e *Entry) bool {
+		return (len(user) == 0 || e.UserID == user || e.UserNick == user) &&
+			(len(cmd) == 0 || e.Command == cmd)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(entries) == 0 {
+		return noEntries, nil
+	}
+
+	var lines []string
+	for _, e := range entries {
+		lines = append(lines, e.String())
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func init() {
+	plugins.RegisterCommand(
+		"audit",
+		"Shows the recent command executions, admin only.",
+		"user 12345 cmd weather 20",
+		audit)
+}
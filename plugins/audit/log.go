@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tidyoux/chatbot/db"
+)
+
+const (
+	namespace = "audit"
+
+	seqKey    = "seq"
+	firstKey  = "first"
+	entryKind = "entry"
+
+	// maxScan bounds how many entries a query walks back through.
+	maxScan = 10000
+)
+
+var (
+	dbInstance = db.New(namespace)
+
+	// logMu serializes appends and pruning of the log.
+	logMu sync.Mutex
+)
+
+// Entry is a single audited command execution.
+type Entry struct {
+	Time     time.Time
+	Channel  string
+	UserID   string
+	UserNick string
+	Command  string
+	Args     string
+	Outcome  string
+	Duration time.Duration
+}
+
+// entryKey returns the key of the entry seq, zero padded for the entries to
+// be sorted.
+func entryKey(seq int64) []byte {
+	return db.Key(entryKind, fmt.Sprintf("%020d", seq))
+}
+
+func getCounter(key string) (int64, error) {
+	return dbInstance.GetInt([]byte(key))
+}
+
+func getEntry(seq int64) (*Entry, error) {
+	var e Entry
+	ok, err := dbInstance.GetJSON(entryKey(seq), &e)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func appendEntry(e *Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	seq, err := dbInstance.Incr([]byte(seqKey), 1)
+	if err != nil {
+		return err
+	}
+	return dbInstance.Set(entryKey(seq-1), data)
+}
+
+// recent returns up to n of the newest entries accepted by match, newest first.
+func recent(n int, match func(e *Entry) bool) ([]*Entry, error) {
+	seq, err := getCounter(seqKey)
+	if err != nil {
+		return nil, err
+	}
+
+	first, err := getCounter(firstKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for i := 0; seq > first && i < maxScan && len(entries) < n; i++ {
+		seq--
+		e, err := getEntry(seq)
+		if err != nil {
+			return nil, err
+		}
+
+		if e != nil && match(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// prune deletes the entries recorded before t.
+func prune(t time.Time) (int, error) {
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	seq, err := getCounter(seqKey)
+	if err != nil {
+		return 0, err
+	}
+
+	first, err := getCounter(firstKey)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for ; first < seq; first++ {
+		e, err := getEntry(first)
+		if err != nil {
+			return count, err
+		}
+
+		if e != nil && !e.Time.Before(t) {
+			break
+		}
+
+		err = dbInstance.Delete(entryKey(first))
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, dbInstance.SetInt([]byte(firstKey), first)
+}
@@ -0,0 +1,28 @@
+package cancel
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-chat-bot/bot"
+	"github.com/tidyoux/chatbot/plugins"
+)
+
+func cancel(_ context.Context, command *bot.Cmd) (string, error) {
+	var name string
+	if len(command.Args) > 0 {
+		name = strings.TrimPrefix(command.Args[0], bot.CmdPrefix)
+	}
+
+	count := plugins.Cancel(command, name)
+	return fmt.Sprintf("%d command(s) canceled", count), nil
+}
+
+func init() {
+	plugins.RegisterCommand(
+		"cancel",
+		"Cancels the commands running in this chat, or only those of the given name.",
+		"lifeline",
+		cancel)
+}
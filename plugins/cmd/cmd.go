@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"os/exec"
 
@@ -14,7 +15,7 @@ var (
 	errDisableCmd = errors.New("command is disabled")
 )
 
-func cmd(command *bot.Cmd) (string, error) {
+func cmd(ctx context.Context, command *bot.Cmd) (string, error) {
 	if len(command.Args) < 1 {
 		return plugins.InvalidAmountOfParams, nil
 	}
@@ -22,19 +23,19 @@ func cmd(command *bot.Cmd) (string, error) {
 	if _, ok := disableCmds[command.Args[0]]; ok {
 		return "", errDisableCmd
 	}
-	cmd := exec.Command("/bin/bash", "-c", command.RawArgs)
+	cmd := exec.CommandContext(ctx, "/bin/bash", "-c", command.RawArgs)
 	data, err := cmd.CombinedOutput()
 	return string(data), err
 }
 
-func cmdV3(command *bot.Cmd) (result bot.CmdResultV3, err error) {
+func cmdV3(ctx context.Context, command *bot.Cmd) (result bot.CmdResultV3, err error) {
 	result = bot.CmdResultV3{Message: make(chan string), Done: make(chan bool)}
 	if _, ok := disableCmds[command.Args[0]]; ok {
 		err = errDisableCmd
 		return
 	}
 
-	cmd := exec.Command("/bin/bash", "-c", command.RawArgs)
+	cmd := exec.CommandContext(ctx, "/bin/bash", "-c", command.RawArgs)
 	var b bytes.Buffer
 	cmd.Stdout = &b
 	cmd.Stderr = &b
@@ -64,12 +65,12 @@ func cmdV3(command *bot.Cmd) (result bot.CmdResultV3, err error) {
 }
 
 func init() {
-	bot.RegisterCommand(
+	plugins.RegisterCommand(
 		"cmd",
 		"run cmd on system",
 		"pwd",
 		cmd)
-	bot.RegisterCommandV3(
+	plugins.RegisterCommandV3(
 		"cmdv3",
 		"run cmd on system",
 		"pwd",
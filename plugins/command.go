@@ -0,0 +1,133 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/go-chat-bot/bot"
+)
+
+// CmdFunc handles a command, giving up once ctx is done.
+type CmdFunc func(ctx context.Context, cmd *bot.Cmd) (string, error)
+
+// CmdFuncV3 handles a command streaming its messages, giving up once ctx
+// is done. The context lasts until the result is done.
+type CmdFuncV3 func(ctx context.Context, cmd *bot.Cmd) (bot.CmdResultV3, error)
+
+// Middleware wraps the execution of commands. It may inspect or alter the
+// command before calling next, inspect the outcome afterwards, or
+// short-circuit by replying without calling next at all.
+type Middleware func(next CmdFunc) CmdFunc
+
+var (
+	middlewaresMu sync.RWMutex
+	middlewares   []Middleware
+
+	commandsMu sync.RWMutex
+	commands   = make(map[string]bool)
+)
+
+// Use appends mws to the middlewares commands run through, the first
+// being the outermost.
+func Use(mws ...Middleware) {
+	middlewaresMu.Lock()
+	defer middlewaresMu.Unlock()
+	middlewares = append(middlewares, mws...)
+}
+
+func chain(f CmdFunc) CmdFunc {
+	middlewaresMu.RLock()
+	defer middlewaresMu.RUnlock()
+
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		f = middlewares[i](f)
+	}
+	return f
+}
+
+func addCommand(command string) {
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	commands[command] = true
+}
+
+// IsCommand reports whether command is registered.
+func IsCommand(command string) bool {
+	commandsMu.RLock()
+	defer commandsMu.RUnlock()
+	return commands[command]
+}
+
+// RegisterCommand registers cmdFunc with the bot like bot.RegisterCommand,
+// running it through the middlewares.
+func RegisterCommand(command, description, exampleArgs string, cmdFunc CmdFunc) {
+	addCommand(command)
+	bot.RegisterCommand(command, description, exampleArgs, func(cmd *bot.Cmd) (string, error) {
+		ctx, done := begin(cmd)
+		defer done()
+		return chain(cmdFunc)(ctx, cmd)
+	})
+}
+
+// RegisterCommandV3 registers cmdFunc with the bot like bot.RegisterCommandV3,
+// running it through the middlewares, which see it as done once its result
+// is. The channel of its result is ignored. Goroutines started by cmdFunc
+// should use Go.
+func RegisterCommandV3(command, description, exampleArgs string, cmdFunc CmdFuncV3) {
+	addCommand(command)
+	bot.RegisterCommandV3(command, description, exampleArgs, func(cmd *bot.Cmd) (bot.CmdResultV3, error) {
+		out := bot.CmdResultV3{
+			Message: make(chan string),
+			Done:    make(chan bool),
+		}
+		go func() {
+			ctx, done := begin(cmd)
+			defer done()
+
+			msg, err := chain(stream(cmdFunc, out.Message))(ctx, cmd)
+			if err != nil {
+				msg = fmt.Sprintf("Error executing %s: %s", cmd.Command, err)
+				log.Println(msg)
+			}
+
+			if len(msg) > 0 {
+				out.Message <- msg
+			}
+			out.Done <- true
+		}()
+		return out, nil
+	})
+}
+
+// stream adapts cmdFunc to a CmdFunc forwarding the messages of its result
+// to msgch until it's done.
+func stream(cmdFunc CmdFuncV3, msgch chan<- string) CmdFunc {
+	return func(ctx context.Context, cmd *bot.Cmd) (string, error) {
+		result, err := cmdFunc(ctx, cmd)
+		if err != nil {
+			return "", err
+		}
+
+		for {
+			select {
+			case msg, ok := <-result.Message:
+				if !ok {
+					result.Message = nil
+					continue
+				}
+
+				select {
+				case msgch <- msg:
+				case <-ctx.Done():
+					return "", ctxError(ctx)
+				}
+			case <-result.Done:
+				return "", nil
+			case <-ctx.Done():
+				return "", ctxError(ctx)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-chat-bot/bot"
+)
+
+// DefaultTimeout is how long a command may run unless configured otherwise.
+const DefaultTimeout = time.Minute
+
+var (
+	errTimedOut = errors.New("timed out")
+	errCanceled = errors.New("canceled")
+
+	rootCtx, rootCancel = context.WithCancel(context.Background())
+
+	runningMu sync.Mutex
+	running   = make(map[*bot.Cmd]context.CancelFunc)
+)
+
+// begin returns the context cmd runs in, and the func to call once it's done.
+func begin(cmd *bot.Cmd) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(rootCtx)
+
+	runningMu.Lock()
+	running[cmd] = cancel
+	runningMu.Unlock()
+
+	return ctx, func() {
+		runningMu.Lock()
+		delete(running, cmd)
+		runningMu.Unlock()
+		cancel()
+	}
+}
+
+// ctxError translates the error of a finished context into a reply.
+func ctxError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return errTimedOut
+	}
+	return errCanceled
+}
+
+// Timeout returns a middleware bounding how long commands may run: the
+// given per command timeouts, or def for the others, zero meaning no limit.
+// Once the deadline passes or the command is canceled, it replies without
+// waiting for the command. As the rest of the chain runs in a goroutine of
+// its own, Recover should come after it.
+func Timeout(def time.Duration, perCommand map[string]time.Duration) Middleware {
+	timeouts := make(map[string]time.Duration)
+	for command, timeout := range perCommand {
+		timeouts[command] = timeout
+	}
+
+	return func(next CmdFunc) CmdFunc {
+		return func(ctx context.Context, cmd *bot.Cmd) (string, error) {
+			timeout, ok := timeouts[cmd.Command]
+			if !ok {
+				timeout = def
+			}
+
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			type reply struct {
+				msg string
+				err error
+			}
+			replies := make(chan reply, 1)
+			go func() {
+				msg, err := next(ctx, cmd)
+				replies <- reply{msg, err}
+			}()
+
+			select {
+			case r := <-replies:
+				return r.msg, r.err
+			case <-ctx.Done():
+				return "", ctxError(ctx)
+			}
+		}
+	}
+}
+
+// Cancel cancels the other commands running in the chat of by, only those
+// named command unless it's empty, and returns how many were canceled.
+func Cancel(by *bot.Cmd, command string) int {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+
+	var count int
+	for cmd, cancel := range running {
+		if cmd != by && cmd.Channel == by.Channel && (len(command) == 0 || cmd.Command == command) {
+			cancel()
+			count++
+		}
+	}
+	return count
+}
+
+// Background returns the context of the work plugins do unprompted, canceled
+// by Shutdown.
+func Background() context.Context {
+	return rootCtx
+}
+
+// Shutdown cancels all running commands and the ones started afterwards.
+func Shutdown() {
+	rootCancel()
+}
@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"context"
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
@@ -23,7 +24,7 @@ func encryptSHA256(data []byte) string {
 	return fmt.Sprintf("%x", sha256.Sum256(data))
 }
 
-func crypto(command *bot.Cmd) (string, error) {
+func crypto(_ context.Context, command *bot.Cmd) (string, error) {
 	if len(command.Args) < 2 {
 		return plugins.InvalidAmountOfParams, nil
 	}
@@ -42,7 +43,7 @@ func crypto(command *bot.Cmd) (string, error) {
 }
 
 func init() {
-	bot.RegisterCommand(
+	plugins.RegisterCommand(
 		"crypto",
 		"Encrypts the input data from its hash value",
 		"md5|sha-1|sha-256 enter here text to encrypt",
@@ -1,8 +1,11 @@
 package db
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/go-chat-bot/bot"
 	"github.com/tidyoux/chatbot/db"
@@ -12,45 +15,222 @@ import (
 const (
 	namespace = "db"
 
-	success = "status:ok"
+	success     = "status:ok"
+	keyNotFound = "key %s not found"
+	noKeys      = "no keys"
+	overQuota   = "quota of %d bytes exceeded"
+
+	// maxListed bounds how many keys are listed.
+	maxListed = 100
+)
+
+var (
+	dbInstance = db.New(namespace)
 )
 
-func dbop(command *bot.Cmd) (string, error) {
-	if len(command.Args) < 2 {
+// SetStore makes the plugin keep its keys in store.
+func SetStore(store db.Store) {
+	dbInstance = db.NewWithStore(store, namespace)
+}
+
+func get(s scope, key string) (string, error) {
+	v, err := dbInstance.Get(s.key(key))
+	if err != nil {
+		return "", err
+	}
+	return success + fmt.Sprintf("\ndata:%s", string(v)), nil
+}
+
+func set(s scope, key, value, author string) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	v := &Version{
+		Value:  value,
+		Author: author,
+		Time:   time.Now(),
+	}
+	ok, err := fitsVersion(s, key, v)
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return fmt.Sprintf(overQuota, s.quota()), nil
+	}
+
+	err = write(s, key, v)
+	if err != nil {
+		return "", err
+	}
+	return success, nil
+}
+
+func del(s scope, key, author string) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ok, err := dbInstance.Has(s.key(key))
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return fmt.Sprintf(keyNotFound, key), nil
+	}
+
+	v := &Version{
+		Deleted: true,
+		Author:  author,
+		Time:    time.Now(),
+	}
+	ok, err = fitsVersion(s, key, v)
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return fmt.Sprintf(overQuota, s.quota()), nil
+	}
+
+	err = write(s, key, v)
+	if err != nil {
+		return "", err
+	}
+	return success, nil
+}
+
+// purgeKey deletes key along with its history, which counts in the quota.
+func purgeKey(s scope, key string) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ok, err := dbInstance.Has(s.key(key))
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		versions, err := loadHistory(s, key)
+		if err != nil {
+			return "", err
+		}
+
+		if len(versions) == 0 {
+			return fmt.Sprintf(keyNotFound, key), nil
+		}
+	}
+
+	err = purge(s, key)
+	if err != nil {
+		return "", err
+	}
+	return success, nil
+}
+
+func keys(s scope, prefix string) (string, error) {
+	var names []string
+	err := dbInstance.Iterate(s.key(prefix), func(key, _ []byte) bool {
+		names = append(names, s.name(key))
+		return len(names) <= maxListed
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(names) == 0 {
+		return noKeys, nil
+	}
+
+	sort.Strings(names)
+	if len(names) > maxListed {
+		names = append(names[:maxListed], "...")
+	}
+	return strings.Join(names, "\n"), nil
+}
+
+func dbop(_ context.Context, command *bot.Cmd) (string, error) {
+	if len(command.Args) < 1 {
 		return plugins.InvalidAmountOfParams, nil
 	}
 
-	db := db.New(namespace)
+	author := command.User.Nick
+	if len(author) == 0 {
+		author = command.User.ID
+	}
 
 	op := command.Args[0]
-	key := []byte(command.Args[1])
-	switch op {
-	case "set":
-		var data []byte
-		if len(command.Args) > 2 {
-			data = []byte(strings.Join(command.Args[2:], " "))
+	args := command.Args[1:]
+	s := chatScope(command.Channel)
+	if len(args) > 0 {
+		switch args[0] {
+		case userFlag:
+			s = userScope(command.User.ID)
+			args = args[1:]
+		case globalFlag:
+			if !plugins.IsAdmin(command.User) {
+				return plugins.PermissionDenied, nil
+			}
+			s = globalScope()
+			args = args[1:]
 		}
+	}
 
-		err := db.Set(key, data)
-		if err != nil {
-			return "", err
+	switch op {
+	case "set":
+		if len(args) < 1 {
+			return plugins.InvalidAmountOfParams, nil
 		}
-		return success, nil
+		return set(s, args[0], strings.Join(args[1:], " "), author)
 	case "get":
-		v, err := db.Get(key)
-		if err != nil {
-			return "", err
+		if len(args) != 1 {
+			return plugins.InvalidAmountOfParams, nil
+		}
+		return get(s, args[0])
+	case "del":
+		if len(args) != 1 {
+			return plugins.InvalidAmountOfParams, nil
+		}
+		return del(s, args[0], author)
+	case "purge":
+		if len(args) != 1 {
+			return plugins.InvalidAmountOfParams, nil
+		}
+		return purgeKey(s, args[0])
+	case "keys":
+		if len(args) > 1 {
+			return plugins.InvalidAmountOfParams, nil
+		}
+		return keys(s, strings.Join(args, ""))
+	case "history":
+		if len(args) != 1 {
+			return plugins.InvalidAmountOfParams, nil
+		}
+		return history(s, args[0])
+	case "revert":
+		if len(args) != 2 {
+			return plugins.InvalidAmountOfParams, nil
+		}
+		return revert(s, args[0], args[1], author)
+	case "watch":
+		if len(args) != 1 {
+			return plugins.InvalidAmountOfParams, nil
+		}
+		return watch(s, args[0], command.Channel)
+	case "unwatch":
+		if len(args) != 1 {
+			return plugins.InvalidAmountOfParams, nil
 		}
-		return success + fmt.Sprintf("\ndata:%s", string(v)), nil
+		return unwatch(s, args[0], command.Channel)
 	default:
 		return plugins.InvalidParams, nil
 	}
 }
 
 func init() {
-	bot.RegisterCommand(
+	plugins.RegisterCommand(
 		"db",
-		"Stores key-value into db.",
-		"set key value (or, get key)",
+		"Stores key-value into db, shared by the chat, private to you with -u, or global with -g (admins only).",
+		"set [-u|-g] key value (or, get [-u|-g] key, or, del [-u|-g] key, or, purge [-u|-g] key, or, keys [-u|-g] [prefix], or, history [-u|-g] key, or, revert [-u|-g] key 2, or, watch [-u|-g] key, or, unwatch [-u|-g] key)",
 		dbop)
 }
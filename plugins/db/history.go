@@ -0,0 +1,175 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidyoux/chatbot/db"
+)
+
+const (
+	DefaultHistory = 10
+
+	historyKind = "history"
+
+	noHistory       = "no history of %s"
+	versionNotFound = "version %s of %s not found"
+)
+
+// Version is a value a key had.
+type Version struct {
+	Version int
+	Value   string
+	Deleted bool
+	Author  string
+	Time    time.Time
+}
+
+func historyKey(s scope, key string) []byte {
+	return db.Key(historyKind, s.kind, s.id, key)
+}
+
+func loadHistory(s scope, key string) ([]*Version, error) {
+	var versions []*Version
+	_, err := dbInstance.GetJSON(historyKey(s, key), &versions)
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// nextHistory returns the history of key once v is written.
+func nextHistory(s scope, key string, v *Version) ([]*Version, error) {
+	versions, err := loadHistory(s, key)
+	if err != nil {
+		return nil, err
+	}
+
+	v.Version = 1
+	if len(versions) > 0 {
+		v.Version = versions[len(versions)-1].Version + 1
+	}
+	versions = append(versions, v)
+	if config.History > 0 && len(versions) > config.History {
+		versions = versions[len(versions)-config.History:]
+	}
+	return versions, nil
+}
+
+// fitsVersion reports whether writing v, with its history, keeps the scope
+// in its quota.
+func fitsVersion(s scope, key string, v *Version) (bool, error) {
+	versions, err := nextHistory(s, key, v)
+	if err != nil {
+		return false, err
+	}
+
+	watchers, err := loadWatchers(s, key)
+	if err != nil {
+		return false, err
+	}
+	return s.fits(key, footprint(key, v, versions, watchers))
+}
+
+// write sets key to value, or deletes it, recording the version in its
+// history along.
+func write(s scope, key string, v *Version) error {
+	versions, err := nextHistory(s, key, v)
+	if err != nil {
+		return err
+	}
+
+	b := dbInstance.NewBatch()
+	if v.Deleted {
+		b.Delete(s.key(key))
+	} else {
+		b.Set(s.key(key), []byte(v.Value))
+	}
+
+	if config.History > 0 {
+		err = b.SetJSON(historyKey(s, key), versions)
+		if err != nil {
+			return err
+		}
+	}
+	return b.Write()
+}
+
+// purge deletes key along with its history.
+func purge(s scope, key string) error {
+	b := dbInstance.NewBatch()
+	b.Delete(s.key(key))
+	b.Delete(historyKey(s, key))
+	return b.Write()
+}
+
+func history(s scope, key string) (string, error) {
+	versions, err := loadHistory(s, key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(versions) == 0 {
+		return fmt.Sprintf(noHistory, key), nil
+	}
+
+	var lines []string
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		value := v.Value
+		if v.Deleted {
+			value = "(deleted)"
+		}
+		lines = append(lines, fmt.Sprintf("v%d %s by %s: %s", v.Version, v.Time.Format("2006-01-02 15:04"), v.Author, value))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func revert(s scope, key, version, author string) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	versions, err := loadHistory(s, key)
+	if err != nil {
+		return "", err
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return fmt.Sprintf(versionNotFound, version, key), nil
+	}
+
+	var old *Version
+	for _, v := range versions {
+		if v.Version == n {
+			old = v
+		}
+	}
+
+	if old == nil {
+		return fmt.Sprintf(versionNotFound, version, key), nil
+	}
+
+	v := &Version{
+		Value:   old.Value,
+		Deleted: old.Deleted,
+		Author:  author,
+		Time:    time.Now(),
+	}
+	ok, err := fitsVersion(s, key, v)
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return fmt.Sprintf(overQuota, s.quota()), nil
+	}
+
+	err = write(s, key, v)
+	if err != nil {
+		return "", err
+	}
+	return success, nil
+}
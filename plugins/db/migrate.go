@@ -0,0 +1,29 @@
+package db
+
+import (
+	"bytes"
+
+	"github.com/tidyoux/chatbot/db"
+)
+
+// migrateGlobalScope moves the keys stored before the scopes to the global
+// scope.
+func migrateGlobalScope(tx *db.Tx) error {
+	return tx.Iterate(nil, func(key, value []byte) bool {
+		if bytes.IndexByte(key, 0) >= 0 {
+			return true
+		}
+
+		tx.Set(globalScope().key(string(key)), value)
+		tx.Delete(key)
+		return true
+	})
+}
+
+func init() {
+	db.RegisterMigration(namespace, db.Migration{
+		Version:     1,
+		Description: "move the keys to the global scope",
+		Up:          migrateGlobalScope,
+	})
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/tidyoux/chatbot/db"
+)
+
+const (
+	userFlag   = "-u"
+	globalFlag = "-g"
+
+	DefaultUserQuota   = 64 << 10
+	DefaultChatQuota   = 256 << 10
+	DefaultGlobalQuota = 1 << 20
+)
+
+// Config configures the plugin.
+type Config struct {
+	// The quotas of the scopes, the bytes of the keys and values stored,
+	// zero for no limit.
+	UserQuota   int64
+	ChatQuota   int64
+	GlobalQuota int64
+
+	// History is how many versions of each key are kept.
+	History int
+}
+
+var (
+	// mu serializes the quota checks and the writes.
+	mu sync.Mutex
+
+	config = Config{
+		UserQuota:   DefaultUserQuota,
+		ChatQuota:   DefaultChatQuota,
+		GlobalQuota: DefaultGlobalQuota,
+		History:     DefaultHistory,
+	}
+)
+
+// Configure sets the quotas of the scopes.
+func Configure(cfg Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	config = cfg
+}
+
+// scope is the set of keys of a user, of a chat or of everyone.
+type scope struct {
+	kind string
+	id   string
+}
+
+func userScope(userID string) scope {
+	return scope{"user", userID}
+}
+
+func chatScope(channel string) scope {
+	return scope{"chat", channel}
+}
+
+func globalScope() scope {
+	return scope{"global", ""}
+}
+
+func (s scope) key(key string) []byte {
+	return db.Key(s.kind, s.id, key)
+}
+
+// name returns the key of the scope as given by the user.
+func (s scope) name(key []byte) string {
+	parts := db.SplitKey(key)
+	return parts[len(parts)-1]
+}
+
+func (s scope) quota() int64 {
+	switch s.kind {
+	case "user":
+		return config.UserQuota
+	case "chat":
+		return config.ChatQuota
+	default:
+		return config.GlobalQuota
+	}
+}
+
+// usage returns the bytes stored by the scope, the keys and values, their
+// history and their watchers, but those of key.
+func (s scope) usage(key string) (int64, error) {
+	var size int64
+	for _, prefix := range [][]byte{
+		s.key(""),
+		db.KeyPrefix(historyKind, s.kind, s.id),
+		db.KeyPrefix(watchKind, s.kind, s.id),
+	} {
+		err := dbInstance.Iterate(prefix, func(k, v []byte) bool {
+			if name := s.name(k); name != key {
+				size += int64(len(name) + len(v))
+			}
+			return true
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
+
+// footprint returns the bytes stored for key, its value unless deleted, its
+// history and its watchers.
+func footprint(key string, v *Version, versions []*Version, watchers map[string]bool) int64 {
+	var size int64
+	if v != nil && !v.Deleted {
+		size += int64(len(key) + len(v.Value))
+	}
+
+	if config.History > 0 && len(versions) > 0 {
+		b, _ := json.Marshal(versions)
+		size += int64(len(key) + len(b))
+	}
+
+	if len(watchers) > 0 {
+		b, _ := json.Marshal(watchers)
+		size += int64(len(key) + len(b))
+	}
+	return size
+}
+
+// fits reports whether key taking size bytes keeps the scope in its quota.
+func (s scope) fits(key string, size int64) (bool, error) {
+	quota := s.quota()
+	if quota <= 0 {
+		return true, nil
+	}
+
+	used, err := s.usage(key)
+	if err != nil {
+		return false, err
+	}
+	return used+size <= quota, nil
+}
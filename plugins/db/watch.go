@@ -0,0 +1,156 @@
+package db
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/tidyoux/chatbot/db"
+	"github.com/tidyoux/chatbot/plugins"
+)
+
+const (
+	watchKind = "watch"
+
+	keySet     = "%s set to %s by %s"
+	keyDeleted = "%s deleted by %s"
+	notWatched = "%s isn't watched"
+)
+
+var (
+	// changes are handed to a single goroutine, which looks up their
+	// watchers and notifies them in order, not to block the writers.
+	changes = make(chan db.Change, 64)
+)
+
+func watchKey(s scope, key string) []byte {
+	return db.Key(watchKind, s.kind, s.id, key)
+}
+
+func loadWatchers(s scope, key string) (map[string]bool, error) {
+	channels := make(map[string]bool)
+	_, err := dbInstance.GetJSON(watchKey(s, key), &channels)
+	if err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+func watch(s scope, key, channel string) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	channels, err := loadWatchers(s, key)
+	if err != nil {
+		return "", err
+	}
+
+	channels[channel] = true
+	value, err := dbInstance.Get(s.key(key))
+	if err != nil {
+		return "", err
+	}
+
+	versions, err := loadHistory(s, key)
+	if err != nil {
+		return "", err
+	}
+
+	var v *Version
+	if value != nil {
+		v = &Version{Value: string(value)}
+	}
+	ok, err := s.fits(key, footprint(key, v, versions, channels))
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return fmt.Sprintf(overQuota, s.quota()), nil
+	}
+
+	err = dbInstance.SetJSON(watchKey(s, key), channels)
+	if err != nil {
+		return "", err
+	}
+	return success, nil
+}
+
+func unwatch(s scope, key, channel string) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	channels, err := loadWatchers(s, key)
+	if err != nil {
+		return "", err
+	}
+
+	if !channels[channel] {
+		return fmt.Sprintf(notWatched, key), nil
+	}
+
+	delete(channels, channel)
+	if len(channels) == 0 {
+		err = dbInstance.Delete(watchKey(s, key))
+	} else {
+		err = dbInstance.SetJSON(watchKey(s, key), channels)
+	}
+	if err != nil {
+		return "", err
+	}
+	return success, nil
+}
+
+// notify queues the change of a key for its watchers to be told, dropping
+// it if too many are queued already.
+func notify(c db.Change) {
+	select {
+	case changes <- c:
+	default:
+		log.Println(namespace, "drop the change notification of", db.SplitKey(c.Key))
+	}
+}
+
+// tell tells the chats watching a key of a scope that it changed.
+func tell(c db.Change) {
+	parts := db.SplitKey(c.Key)
+	if len(parts) != 3 {
+		return
+	}
+
+	s, key := scope{parts[0], parts[1]}, parts[2]
+	switch s.kind {
+	case "user", "chat", "global":
+	default:
+		return
+	}
+
+	channels, err := loadWatchers(s, key)
+	if err != nil || len(channels) == 0 {
+		return
+	}
+
+	author := "unknown"
+	versions, err := loadHistory(s, key)
+	if err == nil && len(versions) > 0 {
+		author = versions[len(versions)-1].Author
+	}
+
+	msg := fmt.Sprintf(keySet, key, string(c.Value), author)
+	if c.Deleted {
+		msg = fmt.Sprintf(keyDeleted, key, author)
+	}
+
+	for channel := range channels {
+		plugins.Send(channel, msg)
+	}
+}
+
+func init() {
+	dbInstance.Subscribe(notify)
+
+	go func() {
+		for c := range changes {
+			tell(c)
+		}
+	}()
+}
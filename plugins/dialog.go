@@ -0,0 +1,358 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chat-bot/bot"
+	"github.com/tidyoux/chatbot/db"
+)
+
+const (
+	dialogNamespace = "dialog"
+	dialogCommand   = "dialog"
+	sessionsKey     = "sessions"
+
+	// DefaultDialogTimeout is how long a dialog waits for an answer unless
+	// it sets its own timeout.
+	DefaultDialogTimeout = 10 * time.Minute
+
+	dialogSweepInterval = time.Minute
+	dialogTimedOut      = "%s timed out"
+
+	// dialogGrace is how long the sessions are kept after they time out,
+	// for the sweeper to notify their chats.
+	dialogGrace = 10 * dialogSweepInterval
+)
+
+// Dialog is a multi-step conversation, a set of named steps each asking a
+// question whose answer selects the next step.
+type Dialog struct {
+	Name    string
+	Start   string
+	Steps   map[string]*Step
+	Timeout time.Duration
+}
+
+// Step is a question of a dialog.
+type Step struct {
+	// Prompt returns the question asked.
+	Prompt func(s *Session) string
+
+	// Validate checks an answer, an error is replied and the question asked
+	// again. It may be nil.
+	Validate func(s *Session, answer string) error
+
+	// Answer handles a valid answer, returning a message to reply and the
+	// name of the next step, an empty name ending the dialog.
+	Answer func(s *Session, answer string) (msg string, next string, err error)
+}
+
+// Session is the persisted state of a dialog running in a chat, answered by
+// a single user or, when UserID is empty, by anyone in the chat.
+type Session struct {
+	Dialog  string
+	Step    string
+	Channel string
+	UserID  string
+	Data    map[string]string
+	Expires time.Time
+}
+
+var (
+	dialogDB = db.New(dialogNamespace)
+
+	dialogsMu sync.RWMutex
+	dialogs   = make(map[string]*Dialog)
+
+	// sessionLocks serializes the answers of each session, the other chats
+	// answering meanwhile. The locks are dropped once nobody holds them.
+	sessionLocksMu sync.Mutex
+	sessionLocks   = make(map[string]*sessionLock)
+
+	sweepOnce sync.Once
+)
+
+// RegisterDialog makes d available to StartDialog. Dialogs should be
+// registered in the init func of the plugin, for the sessions persisted
+// before a restart to find them.
+func RegisterDialog(d *Dialog) {
+	dialogsMu.Lock()
+	defer dialogsMu.Unlock()
+	dialogs[d.Name] = d
+}
+
+func getDialog(name string) (*Dialog, bool) {
+	dialogsMu.RLock()
+	defer dialogsMu.RUnlock()
+
+	d, ok := dialogs[name]
+	return d, ok
+}
+
+func sessionKey(channel, userID string) []byte {
+	return db.Key(sessionsKey, channel, userID)
+}
+
+type sessionLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lockSession locks the session of key, returning the func unlocking it.
+func lockSession(key []byte) func() {
+	k := string(key)
+
+	sessionLocksMu.Lock()
+	l, ok := sessionLocks[k]
+	if !ok {
+		l = new(sessionLock)
+		sessionLocks[k] = l
+	}
+	l.refs++
+	sessionLocksMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+
+		sessionLocksMu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(sessionLocks, k)
+		}
+		sessionLocksMu.Unlock()
+	}
+}
+
+func (d *Dialog) timeout() time.Duration {
+	if d.Timeout > 0 {
+		return d.Timeout
+	}
+	return DefaultDialogTimeout
+}
+
+func loadSession(key []byte) (*Session, error) {
+	var s Session
+	ok, err := dialogDB.GetJSON(key, &s)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func saveSession(s *Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return dialogDB.SetWithTTL(sessionKey(s.Channel, s.UserID), data, time.Until(s.Expires)+dialogGrace)
+}
+
+func deleteSession(key []byte) error {
+	return dialogDB.Delete(key)
+}
+
+// StartDialog starts the named dialog in channel, answered by userID or by
+// anyone in the chat if it's empty, replacing the dialog running there.
+// It returns the first question to reply.
+func StartDialog(name string, channel, userID string, data map[string]string) (string, error) {
+	d, ok := getDialog(name)
+	if !ok {
+		return "", fmt.Errorf("unknown dialog %s", name)
+	}
+
+	step, ok := d.Steps[d.Start]
+	if !ok {
+		return "", fmt.Errorf("dialog %s has no step %s", name, d.Start)
+	}
+
+	if data == nil {
+		data = make(map[string]string)
+	}
+
+	defer lockSession(sessionKey(channel, userID))()
+
+	s := &Session{
+		Dialog:  name,
+		Step:    d.Start,
+		Channel: channel,
+		UserID:  userID,
+		Data:    data,
+		Expires: time.Now().Add(d.timeout()),
+	}
+	err := saveSession(s)
+	if err != nil {
+		return "", err
+	}
+	return step.Prompt(s), nil
+}
+
+// EndDialog ends the dialog running in channel for userID, or for the chat
+// if it's empty.
+func EndDialog(channel, userID string) error {
+	key := sessionKey(channel, userID)
+	defer lockSession(key)()
+	return deleteSession(key)
+}
+
+// StartDialogs starts expiring the sessions which timed out, notifying
+// their chats.
+func StartDialogs() {
+	sweepOnce.Do(func() {
+		go func() {
+			for range time.Tick(dialogSweepInterval) {
+				err := sweepDialogs(time.Now())
+				if err != nil {
+					log.Println(dialogNamespace, err)
+				}
+			}
+		}()
+	})
+}
+
+// sweepDialogs ends the sessions which timed out, the db expiring them
+// later on.
+func sweepDialogs(now time.Time) error {
+	var expired [][]byte
+	err := dialogDB.Iterate(db.KeyPrefix(sessionsKey), func(key, value []byte) bool {
+		var s Session
+		if json.Unmarshal(value, &s) == nil && !now.Before(s.Expires) {
+			expired = append(expired, key)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range expired {
+		err := sweepSession(key, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sweepSession(key []byte, now time.Time) error {
+	defer lockSession(key)()
+
+	s, err := loadSession(key)
+	if err != nil || s == nil || now.Before(s.Expires) {
+		return err
+	}
+
+	err = deleteSession(key)
+	if err != nil {
+		return err
+	}
+
+	Send(s.Channel, fmt.Sprintf(dialogTimedOut, s.Dialog))
+	return nil
+}
+
+// answerDialog answers the dialog of the user in the chat, or else the one
+// of the chat, running the step through the middlewares like a command.
+func answerDialog(cmd *bot.PassiveCmd) (string, error) {
+	if cmd.User == nil || strings.HasPrefix(strings.TrimSpace(cmd.Raw), bot.CmdPrefix) {
+		return "", nil
+	}
+
+	for _, userID := range []string{cmd.User.ID, ""} {
+		key := sessionKey(cmd.Channel, userID)
+		ok, err := dialogDB.Has(key)
+		if err != nil {
+			return "", err
+		}
+
+		if !ok {
+			continue
+		}
+
+		answer := strings.TrimSpace(cmd.Raw)
+		c := &bot.Cmd{
+			Raw:         cmd.Raw,
+			Channel:     cmd.Channel,
+			ChannelData: cmd.ChannelData,
+			User:        cmd.User,
+			Message:     cmd.Raw,
+			MessageData: cmd.MessageData,
+			Command:     dialogCommand,
+			RawArgs:     answer,
+			Args:        strings.Fields(answer),
+		}
+		ctx, done := begin(c)
+		defer done()
+
+		return chain(func(_ context.Context, _ *bot.Cmd) (string, error) {
+			return answerSession(key, answer)
+		})(ctx, c)
+	}
+	return "", nil
+}
+
+// answerSession answers the session of key, if it's still running.
+func answerSession(key []byte, answer string) (string, error) {
+	defer lockSession(key)()
+
+	s, err := loadSession(key)
+	if err != nil || s == nil {
+		return "", err
+	}
+	return answerStep(key, s, answer)
+}
+
+func answerStep(key []byte, s *Session, answer string) (string, error) {
+	d, ok := getDialog(s.Dialog)
+	if !ok || time.Now().After(s.Expires) {
+		return "", deleteSession(key)
+	}
+
+	step, ok := d.Steps[s.Step]
+	if !ok {
+		return "", deleteSession(key)
+	}
+
+	if step.Validate != nil {
+		if err := step.Validate(s, answer); err != nil {
+			return err.Error() + "\n" + step.Prompt(s), nil
+		}
+	}
+
+	msg, next, err := step.Answer(s, answer)
+	if err != nil {
+		return "", err
+	}
+
+	if len(next) == 0 {
+		return msg, deleteSession(key)
+	}
+
+	nextStep, ok := d.Steps[next]
+	if !ok {
+		deleteSession(key)
+		return "", fmt.Errorf("dialog %s has no step %s", d.Name, next)
+	}
+
+	s.Step = next
+	s.Expires = time.Now().Add(d.timeout())
+	err = saveSession(s)
+	if err != nil {
+		return "", err
+	}
+
+	if len(msg) > 0 {
+		msg += "\n"
+	}
+	return msg + nextStep.Prompt(s), nil
+}
+
+func init() {
+	bot.RegisterPassiveCommand(dialogCommand, answerDialog)
+}
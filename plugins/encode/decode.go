@@ -1,6 +1,7 @@
 package encoding
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"strings"
@@ -9,7 +10,7 @@ import (
 	"github.com/tidyoux/chatbot/plugins"
 )
 
-func decode(command *bot.Cmd) (string, error) {
+func decode(_ context.Context, command *bot.Cmd) (string, error) {
 	if len(command.Args) < 2 {
 		return plugins.InvalidAmountOfParams, nil
 	}
@@ -40,7 +41,7 @@ func decodeBase64(str string) (string, error) {
 }
 
 func init() {
-	bot.RegisterCommand(
+	plugins.RegisterCommand(
 		"decode",
 		"Decodes the given string",
 		"base64 VGhlIEdvIFByb2dyYW1taW5nIExhbmd1YWdl",
@@ -1,6 +1,7 @@
 package encoding
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"strings"
@@ -9,7 +10,7 @@ import (
 	"github.com/tidyoux/chatbot/plugins"
 )
 
-func encode(command *bot.Cmd) (string, error) {
+func encode(_ context.Context, command *bot.Cmd) (string, error) {
 	if len(command.Args) < 2 {
 		return plugins.InvalidAmountOfParams, nil
 	}
@@ -37,7 +38,7 @@ func encodeBase64(str string) (string, error) {
 }
 
 func init() {
-	bot.RegisterCommand(
+	plugins.RegisterCommand(
 		"encode",
 		"Allows you encoding a value",
 		"base64 enter here text to encode",
@@ -1,18 +1,20 @@
 package hello
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/go-chat-bot/bot"
+	"github.com/tidyoux/chatbot/plugins"
 )
 
-func hello(command *bot.Cmd) (string, error) {
+func hello(_ context.Context, command *bot.Cmd) (string, error) {
 	msg := fmt.Sprintf("Hello %s!", command.User.RealName)
 	return msg, nil
 }
 
 func init() {
-	bot.RegisterCommand(
+	plugins.RegisterCommand(
 		"hello",
 		"Sends a 'Hello' message to you on the channel.",
 		"",
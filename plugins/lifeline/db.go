@@ -1,42 +1,117 @@
 package lifeline
 
-import "github.com/tidyoux/chatbot/db"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/tidyoux/chatbot/db"
+)
 
 const (
 	namespace = "lifeline"
 
 	sectionKey = "section"
 	statusKey  = "status"
+	resumeKey  = "resume"
+	speedKey   = "speed"
+	storyKey   = "story"
 )
 
 var (
 	dbInstance = db.New(namespace)
 )
 
-func getDBData(key string) (string, error) {
-	sec, err := dbInstance.Get([]byte(key))
+// SetStore makes the plugin keep its state in store.
+func SetStore(store db.Store) {
+	dbInstance = db.NewWithStore(store, namespace)
+}
+
+func getDBData(key []byte) (string, error) {
+	sec, err := dbInstance.Get(key)
 	if err != nil {
 		return "", err
 	}
 	return string(sec), nil
 }
 
-func setDBData(key string, value string) error {
-	return dbInstance.Set([]byte(key), []byte(value))
+func setDBData(key []byte, value string) error {
+	return dbInstance.Set(key, []byte(value))
+}
+
+// getStoryName returns the story the chat plays, the default one if it
+// didn't pick any.
+func getStoryName(channel string) (string, error) {
+	name, err := getDBData(db.Key(channel, storyKey))
+	if err != nil || len(name) == 0 {
+		return defaultStory, err
+	}
+	return name, nil
+}
+
+func setStoryName(channel string, name string) error {
+	return setDBData(db.Key(channel, storyKey), name)
+}
+
+func getSection(channel string, story string) (string, error) {
+	return getDBData(db.Key(channel, storyKey, story, sectionKey))
+}
+
+func setSection(channel string, story string, section string) error {
+	return setDBData(db.Key(channel, storyKey, story, sectionKey), section)
+}
+
+func getStatus(channel string, story string, key string) (string, bool, error) {
+	k := db.Key(channel, storyKey, story, statusKey, key)
+	v, err := dbInstance.Get(k)
+	if err != nil || v != nil {
+		return string(v), v != nil, err
+	}
+
+	ok, err := dbInstance.Has(k)
+	return "", ok, err
+}
+
+func setStatus(channel string, story string, key string, value string) error {
+	return setDBData(db.Key(channel, storyKey, story, statusKey, key), value)
+}
+
+func getResume(channel string, story string) (time.Time, bool, error) {
+	var t time.Time
+	ok, err := dbInstance.GetJSON(db.Key(resumeKey, channel, story), &t)
+	return t, ok, err
 }
 
-func getSection(channel string) (string, error) {
-	return getDBData(channel + sectionKey)
+func setResume(channel string, story string, t time.Time) error {
+	return dbInstance.SetJSON(db.Key(resumeKey, channel, story), t)
 }
 
-func setSection(channel string, section string) error {
-	return setDBData(channel+sectionKey, section)
+func deleteResume(channel string, story string) error {
+	return dbInstance.Delete(db.Key(resumeKey, channel, story))
 }
 
-func getStatus(channel string, key string) (string, error) {
-	return getDBData(channel + statusKey + key)
+// dueResumes returns the chats and stories which should resume by now.
+func dueResumes(now time.Time) ([][2]string, error) {
+	var due [][2]string
+	err := dbInstance.Iterate(db.KeyPrefix(resumeKey), func(key, value []byte) bool {
+		var t time.Time
+		if json.Unmarshal(value, &t) == nil && !now.Before(t) {
+			parts := db.SplitKey(key)
+			due = append(due, [2]string{parts[1], parts[2]})
+		}
+		return true
+	})
+	return due, err
+}
+
+func getSpeed(channel string) (float64, error) {
+	var speed float64
+	ok, err := dbInstance.GetJSON(db.Key(channel, speedKey), &speed)
+	if err != nil || !ok {
+		return 1, err
+	}
+	return speed, nil
 }
 
-func setStatus(channel string, key string, value string) error {
-	return setDBData(channel+statusKey+key, value)
+func setSpeed(channel string, speed float64) error {
+	return dbInstance.SetJSON(db.Key(channel, speedKey), speed)
 }
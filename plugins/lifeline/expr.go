@@ -0,0 +1,466 @@
+package lifeline
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// value is the result of an expression: a float64, a string or a bool.
+type value interface{}
+
+// env resolves the variables of expressions.
+type env func(name string) (value, error)
+
+// unsetError is the error of the variables which aren't set.
+type unsetError string
+
+func (e unsetError) Error() string {
+	return fmt.Sprintf("$%s isn't set", string(e))
+}
+
+type expr interface {
+	eval(e env) (value, error)
+}
+
+func formatValue(v value) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+// parseValue returns the value of a variable as stored, a number or a bool
+// if it looks like one.
+func parseValue(s string) value {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return s
+}
+
+func truthy(v value) bool {
+	switch v := v.(type) {
+	case float64:
+		return v != 0
+	case bool:
+		return v
+	case string:
+		return len(v) > 0
+	}
+	return false
+}
+
+type literal struct {
+	v value
+}
+
+func (l *literal) eval(e env) (value, error) {
+	return l.v, nil
+}
+
+type variable struct {
+	name string
+}
+
+func (v *variable) eval(e env) (value, error) {
+	return e(v.name)
+}
+
+type unary struct {
+	op string
+	x  expr
+}
+
+func (u *unary) eval(e env) (value, error) {
+	x, err := u.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.op == "not" {
+		return !truthy(x), nil
+	}
+
+	f, ok := x.(float64)
+	if !ok {
+		return nil, fmt.Errorf("can't negate %q", formatValue(x))
+	}
+	return -f, nil
+}
+
+type binary struct {
+	op   string
+	x, y expr
+}
+
+func (b *binary) eval(e env) (value, error) {
+	x, err := b.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+
+	switch b.op {
+	case "and":
+		if !truthy(x) {
+			return false, nil
+		}
+		y, err := b.y.eval(e)
+		return truthy(y), err
+	case "or":
+		if truthy(x) {
+			return true, nil
+		}
+		y, err := b.y.eval(e)
+		return truthy(y), err
+	}
+
+	y, err := b.y.eval(e)
+	if err != nil {
+		return nil, err
+	}
+
+	fx, xNum := x.(float64)
+	fy, yNum := y.(float64)
+	switch b.op {
+	case "eq":
+		if xNum && yNum {
+			return fx == fy, nil
+		}
+		return formatValue(x) == formatValue(y), nil
+	case "neq":
+		if xNum && yNum {
+			return fx != fy, nil
+		}
+		return formatValue(x) != formatValue(y), nil
+	case "lt", "lte", "gt", "gte":
+		var c int
+		switch {
+		case xNum && yNum:
+			c = compareFloats(fx, fy)
+		case !xNum && !yNum:
+			c = strings.Compare(formatValue(x), formatValue(y))
+		default:
+			return nil, fmt.Errorf("can't compare %q and %q", formatValue(x), formatValue(y))
+		}
+
+		switch b.op {
+		case "lt":
+			return c < 0, nil
+		case "lte":
+			return c <= 0, nil
+		case "gt":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	case "+":
+		if xNum && yNum {
+			return fx + fy, nil
+		}
+		return formatValue(x) + formatValue(y), nil
+	}
+
+	if !xNum || !yNum {
+		return nil, fmt.Errorf("invalid operands of %s: %q and %q", b.op, formatValue(x), formatValue(y))
+	}
+
+	switch b.op {
+	case "-":
+		return fx - fy, nil
+	case "*":
+		return fx * fy, nil
+	case "/", "%":
+		if fy == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if b.op == "%" {
+			return math.Mod(fx, fy), nil
+		}
+		// integers divide like they did before the expressions.
+		if isInt(fx) && isInt(fy) {
+			return math.Trunc(fx / fy), nil
+		}
+		return fx / fy, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", b.op)
+}
+
+func isInt(f float64) bool {
+	return f == math.Trunc(f) && !math.IsInf(f, 0)
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// operators maps the operators, in words or symbols, to their canonical
+// form.
+var operators = map[string]string{
+	"is": "eq", "eq": "eq", "==": "eq", "===": "eq",
+	"neq": "neq", "!=": "neq", "!==": "neq",
+	"lt": "lt", "<": "lt",
+	"lte": "lte", "<=": "lte",
+	"gt": "gt", ">": "gt",
+	"gte": "gte", ">=": "gte",
+	"and": "and", "&&": "and",
+	"or": "or", "||": "or",
+	"not": "not", "!": "not",
+	"+": "+", "-": "-", "*": "*", "/": "/", "%": "%",
+	"(": "(", ")": ")",
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenVar
+	tokenOp
+	tokenWord
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokenNumber, s[i:j], i})
+			i = j
+		case c == '"' || c == '\'':
+			j := strings.IndexByte(s[i+1:], c)
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, token{tokenString, s[i+1 : i+1+j], i})
+			i += j + 2
+		case c == '$' || isWordByte(c):
+			j := i + 1
+			for j < len(s) && isWordByte(s[j]) {
+				j++
+			}
+			kind := tokenWord
+			if c == '$' {
+				kind = tokenVar
+				if j == i+1 {
+					return nil, fmt.Errorf("missing variable name at %d", i)
+				}
+			}
+			tokens = append(tokens, token{kind, s[i:j], i})
+			i = j
+		default:
+			op := ""
+			for _, n := range []int{3, 2, 1} {
+				if i+n <= len(s) {
+					if _, ok := operators[s[i:i+n]]; ok {
+						op = s[i : i+n]
+						break
+					}
+				}
+			}
+			if len(op) == 0 {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, token{tokenOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokenEnd, "", len(s)}), nil
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+// parseExpr parses an expression of a story, e.g.:
+// $power is "pod" and ($rations + 1) gte 2
+func parseExpr(s string) (expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %v", s, err)
+	}
+
+	p := &parser{tokens: tokens}
+	x, err := p.parseOr()
+	if err == nil && p.peek().kind != tokenEnd {
+		err = p.unexpected()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %v", s, err)
+	}
+	return x, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+// op returns the canonical operator of the next token, if it's one.
+func (p *parser) op() string {
+	t := p.peek()
+	if t.kind != tokenOp && t.kind != tokenWord {
+		return ""
+	}
+	return operators[t.text]
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokenEnd {
+		return fmt.Errorf("unexpected end")
+	}
+	return fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+func (p *parser) parseBinary(next func() (expr, error), ops ...string) (expr, error) {
+	x, err := next()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := p.op()
+		found := false
+		for _, o := range ops {
+			found = found || op == o
+		}
+		if !found {
+			return x, nil
+		}
+
+		p.i++
+		// "is not" is a neq.
+		if op == "eq" && p.op() == "not" {
+			p.i++
+			op = "neq"
+		}
+
+		y, err := next()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{op, x, y}
+	}
+}
+
+func (p *parser) parseOr() (expr, error) {
+	return p.parseBinary(p.parseAnd, "or")
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	return p.parseBinary(p.parseNot, "and")
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.op() == "not" {
+		p.i++
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{"not", x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	return p.parseBinary(p.parseAdditive, "eq", "neq", "lt", "lte", "gt", "gte")
+}
+
+func (p *parser) parseAdditive() (expr, error) {
+	return p.parseBinary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *parser) parseMultiplicative() (expr, error) {
+	return p.parseBinary(p.parseUnary, "*", "/", "%")
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.op() == "-" {
+		p.i++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{"-", x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos)
+		}
+		p.i++
+		return &literal{f}, nil
+	case tokenString:
+		p.i++
+		return &literal{t.text}, nil
+	case tokenVar:
+		p.i++
+		return &variable{t.text[1:]}, nil
+	case tokenWord:
+		switch t.text {
+		case "true", "false":
+			p.i++
+			return &literal{t.text == "true"}, nil
+		}
+	case tokenOp:
+		if t.text == "(" {
+			p.i++
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+
+			if p.peek().text != ")" {
+				return nil, fmt.Errorf("missing ) of ( at %d", t.pos)
+			}
+			p.i++
+			return x, nil
+		}
+	}
+	return nil, p.unexpected()
+}
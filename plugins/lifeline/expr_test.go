@@ -0,0 +1,128 @@
+package lifeline
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tidyoux/chatbot/db"
+)
+
+func testContext(t *testing.T, status map[string]string) *Context {
+	SetStore(db.NewMemory())
+	for name, v := range status {
+		if err := setStatus("1", defaultStory, name, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Context{ctx: context.Background(), channel: "1", story: defaultStory}
+}
+
+func TestEval(t *testing.T) {
+	ctx := testContext(t, map[string]string{
+		"a":     "3",
+		"b":     "2",
+		"half":  "0.5",
+		"power": "pod",
+		"ok":    "true",
+	})
+
+	for _, c := range []struct {
+		expr string
+		want string
+	}{
+		// precedence
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3", "9"},
+		{"10 - 4 - 3", "3"},
+		{"-$a + 1", "-2"},
+		{"1 + 2 gt 2 and 1", "true"},
+		{"not $ok or $a lt 2", "false"},
+		{"!($a > 5) && $a != 4", "true"},
+
+		// arithmetic
+		{"$a / $b", "1"},
+		{"-7 / 2", "-3"},
+		{"$a / $half", "6"},
+		{"$half / 2", "0.25"},
+		{"$a % $b", "1"},
+		{"$power + \"s\"", "pods"},
+
+		// comparison
+		{"$a is 3", "true"},
+		{"$a eq 3.0", "true"},
+		{"$a neq 3", "false"},
+		{"$a gte 3", "true"},
+		{"$a lte 2", "false"},
+		{"$power is \"pod\"", "true"},
+		{"$power === 'pod'", "true"},
+		{"\"a\" < \"b\"", "true"},
+
+		// logic
+		{"$ok and $power", "true"},
+		{"0 or \"\"", "false"},
+		{"not 0", "true"},
+
+		// unset variables
+		{"$unset", "0"},
+		{"$unset + 1", "1"},
+		{"$unset is 0", "true"},
+		{"not $unset", "true"},
+	} {
+		x, err := parseExpr(c.expr)
+		if err != nil {
+			t.Errorf("parse %q: %v", c.expr, err)
+			continue
+		}
+
+		v, err := x.eval(ctx.env())
+		if err != nil {
+			t.Errorf("eval %q: %v", c.expr, err)
+			continue
+		}
+
+		if got := formatValue(v); got != c.want {
+			t.Errorf("eval %q: got %s, want %s", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"1 +",
+		"(1",
+		"1)",
+		"1 2",
+		"\"x",
+		"$",
+		"$a = 1",
+		"1 # 2",
+	} {
+		if _, err := parseExpr(s); err == nil {
+			t.Errorf("parse %q: expected an error", s)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	ctx := testContext(t, map[string]string{"power": "pod"})
+
+	for _, s := range []string{
+		"1 / 0",
+		"1 % 0",
+		"$power - 1",
+		"$power * 2",
+		"-$power",
+		"$power lt 1",
+	} {
+		x, err := parseExpr(s)
+		if err != nil {
+			t.Errorf("parse %q: %v", s, err)
+			continue
+		}
+
+		if v, err := x.eval(ctx.env()); err == nil {
+			t.Errorf("eval %q: got %s, expected an error", s, formatValue(v))
+		}
+	}
+}
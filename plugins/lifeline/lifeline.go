@@ -1,18 +1,34 @@
 package lifeline
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chat-bot/bot"
-	"github.com/tidyoux/chatbot/plugins/lifeline/data"
+	"github.com/tidyoux/chatbot/plugins"
 )
 
 const (
 	startCmd = "start"
-)
-
-var (
-	storyInstance *Story
+	speedCmd = "speed"
+	listCmd  = "list"
+	playCmd  = "play"
+
+	success      = "status:ok"
+	busy         = "Busy, back in %s"
+	unknownStory = "Unknown story %s"
+	playing      = " (playing)"
+	invalidSpeed = "The speed must be a number between %g and %g"
+
+	// minSpeed and maxSpeed bound the speed, keeping the waits within
+	// time.Duration.
+	minSpeed = 0.01
+	maxSpeed = 1000.0
 )
 
 func closeResultChan(result *bot.CmdResultV3) {
@@ -20,7 +36,7 @@ func closeResultChan(result *bot.CmdResultV3) {
 	close(result.Done)
 }
 
-func lifeline(cmd *bot.Cmd) (bot.CmdResultV3, error) {
+func lifeline(ctx context.Context, cmd *bot.Cmd) (bot.CmdResultV3, error) {
 	result := bot.CmdResultV3{
 		Message: make(chan string),
 		Done:    make(chan bool),
@@ -31,7 +47,7 @@ func lifeline(cmd *bot.Cmd) (bot.CmdResultV3, error) {
 		answer = cmd.Args[0]
 	}
 
-	go func() {
+	plugins.Go(cmd, func() {
 		defer closeResultChan(&result)
 
 		if !getLock(cmd.Channel) {
@@ -40,67 +56,162 @@ func lifeline(cmd *bot.Cmd) (bot.CmdResultV3, error) {
 
 		defer releaseLock(cmd.Channel)
 
+		switch answer {
+		case speedCmd:
+			reply(ctx, result.Message, speed(cmd.Channel, cmd.Args[1:]))
+			return
+		case listCmd:
+			reply(ctx, result.Message, list(cmd.Channel))
+			return
+		}
+
+		name, err := getStoryName(cmd.Channel)
+		if err != nil {
+			log.Println(namespace, err)
+			return
+		}
+
+		if answer == playCmd {
+			if len(cmd.Args) < 2 {
+				reply(ctx, result.Message, plugins.InvalidAmountOfParams)
+				return
+			}
+
+			answer = ""
+			name = strings.Join(cmd.Args[1:], " ")
+			if _, ok := getStory(name); ok {
+				err = setStoryName(cmd.Channel, name)
+				if err != nil {
+					log.Println(namespace, err)
+					return
+				}
+			}
+		}
+
+		story, ok := getStory(name)
+		if !ok {
+			reply(ctx, result.Message, fmt.Sprintf(unknownStory, name))
+			return
+		}
+
+		resumeAt, waiting, err := getResume(cmd.Channel, name)
+		if err != nil {
+			log.Println(namespace, err)
+			return
+		}
+
 		var currentSection string
 		if answer == startCmd {
 			answer = ""
-			err := setSection(cmd.Channel, startSection)
+			if waiting {
+				err = deleteResume(cmd.Channel, name)
+				if err != nil {
+					log.Println(namespace, err)
+					return
+				}
+			}
+
+			err = setSection(cmd.Channel, name, story.start)
 			if err != nil {
 				log.Println(namespace, err)
 				return
 			}
-			currentSection = startSection
+			currentSection = story.start
 		} else {
-			sec, err := getSection(cmd.Channel)
+			if waiting {
+				d := time.Until(resumeAt).Round(time.Minute)
+				if d < time.Minute {
+					d = time.Minute
+				}
+				reply(ctx, result.Message, fmt.Sprintf(busy, d))
+				return
+			}
+
+			sec, err := getSection(cmd.Channel, name)
 			if err != nil {
 				log.Println(namespace, err)
 				return
 			}
 
 			if len(sec) == 0 {
-				err := setSection(cmd.Channel, startSection)
+				err := setSection(cmd.Channel, name, story.start)
 				if err != nil {
 					log.Println(namespace, err)
 					return
 				}
-				currentSection = startSection
+				currentSection = story.start
 			} else {
 				currentSection = sec
 			}
 		}
 
-		var err error
-		ctx := &Context{
+		speed, err := getSpeed(cmd.Channel)
+		if err != nil {
+			log.Println(namespace, err)
+			return
+		}
+
+		err = play(&Context{
+			ctx:            ctx,
 			channel:        cmd.Channel,
+			story:          name,
 			currentSection: currentSection,
+			speed:          speed,
 			msgch:          result.Message,
 			data:           answer,
-		}
-		if len(answer) > 0 {
-			err = storyInstance.Reply(ctx)
-		} else {
-			err = storyInstance.Play(ctx)
-		}
+		})
 		if err != nil {
 			log.Println(namespace, err)
-			return
 		}
-
-		setSection(cmd.Channel, ctx.currentSection)
-	}()
+	})
 
 	return result, nil
 }
 
-func init() {
-	bot.RegisterCommandV3(
-		"lifeline",
-		"Play a game named lifeline.",
-		"start",
-		lifeline)
+func speed(channel string, args []string) string {
+	if len(args) != 1 {
+		return plugins.InvalidAmountOfParams
+	}
 
-	storyInstance = newStory(data.Story)
-	err := storyInstance.Init()
+	v, err := strconv.ParseFloat(args[0], 64)
+	if err != nil || math.IsNaN(v) || v < minSpeed || v > maxSpeed {
+		return fmt.Sprintf(invalidSpeed, minSpeed, maxSpeed)
+	}
+
+	err = setSpeed(channel, v)
 	if err != nil {
-		log.Printf("Error: init lifeline story failed, %v\n", err)
+		log.Println(namespace, err)
+		return err.Error()
 	}
+	return success
+}
+
+// list returns the stories, marking the one the chat plays.
+func list(channel string) string {
+	current, err := getStoryName(channel)
+	if err != nil {
+		log.Println(namespace, err)
+		return err.Error()
+	}
+
+	var lines []string
+	for _, name := range storyNames() {
+		line := name
+		if st, ok := getStory(name); ok && len(st.title) > 0 && st.title != name {
+			line += ": " + st.title
+		}
+		if name == current {
+			line += playing
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func init() {
+	plugins.RegisterCommandV3(
+		"lifeline",
+		"Play a game named lifeline, or the other stories.",
+		"start (or, speed 2, list, play lifeline)",
+		lifeline)
 }
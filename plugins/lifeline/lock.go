@@ -9,11 +9,8 @@ var (
 )
 
 func getLock(channel string) bool {
-	if _, ok := channelLocks.Load(channel); ok {
-		return false
-	}
-	channelLocks.Store(channel, struct{}{})
-	return true
+	_, loaded := channelLocks.LoadOrStore(channel, struct{}{})
+	return !loaded
 }
 
 func releaseLock(channel string) {
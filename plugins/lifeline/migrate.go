@@ -0,0 +1,63 @@
+package lifeline
+
+import (
+	"regexp"
+
+	"github.com/tidyoux/chatbot/db"
+)
+
+// legacyKey matches the keys concatenating the channel, section or status,
+// and the status variable, which are moved under the default story.
+var legacyKey = regexp.MustCompile(`^(-?\d+)(section|status)([^\x00]*)$`)
+
+func migrateCompositeKeys(tx *db.Tx) error {
+	return tx.Iterate(nil, func(key, value []byte) bool {
+		m := legacyKey.FindSubmatch(key)
+		if m == nil {
+			return true
+		}
+
+		channel, kind, name := string(m[1]), string(m[2]), string(m[3])
+		switch {
+		case kind == sectionKey && len(name) == 0:
+			tx.Set(db.Key(channel, storyKey, defaultStory, sectionKey), value)
+		case kind == statusKey:
+			tx.Set(db.Key(channel, storyKey, defaultStory, statusKey, name), value)
+		default:
+			return true
+		}
+
+		tx.Delete(key)
+		return true
+	})
+}
+
+// migrateQuotedValues unquotes the string values stored with their quotes
+// before set evaluated expressions.
+func migrateQuotedValues(tx *db.Tx) error {
+	return tx.Iterate(nil, func(key, value []byte) bool {
+		parts := db.SplitKey(key)
+		if len(parts) != 5 || parts[1] != storyKey || parts[3] != statusKey {
+			return true
+		}
+
+		n := len(value)
+		if n >= 2 && (value[0] == '"' || value[0] == '\'') && value[n-1] == value[0] {
+			tx.Set(key, value[1:n-1])
+		}
+		return true
+	})
+}
+
+func init() {
+	db.RegisterMigration(namespace, db.Migration{
+		Version:     1,
+		Description: "separate the channel, section and status of keys",
+		Up:          migrateCompositeKeys,
+	})
+	db.RegisterMigration(namespace, db.Migration{
+		Version:     2,
+		Description: "unquote the string values of status",
+		Up:          migrateQuotedValues,
+	})
+}
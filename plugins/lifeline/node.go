@@ -1,8 +1,10 @@
 package lifeline
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -28,14 +30,107 @@ const (
 	elseifPrefix = "<<elseif"
 	endifPrefix  = "<<endif"
 	cmdEndPrefix = ">>"
+
+	silentlyPrefix    = "<<silently"
+	endsilentlyPrefix = "<<endsilently"
+	printPrefix       = "<<print"
+	printVarPrefix    = "<<$"
+)
+
+var (
+	// inlineExpr matches the print macros and the variables in texts.
+	inlineExpr = regexp.MustCompile(`<<(.*?)>>|\$([A-Za-z_][A-Za-z0-9_]*)`)
 )
 
 // Context def.
 type Context struct {
+	ctx            context.Context
 	channel        string
+	story          string
 	currentSection string
 	msgch          chan<- string
 	data           string
+
+	// speed divides the delays of the story, if positive.
+	speed float64
+
+	// resumeAt is when the playback should resume, once stopped by a delay.
+	resumeAt time.Time
+
+	// silent is how many silently blocks are being played.
+	silent int
+}
+
+// stopped reports whether the playback is canceled or delayed.
+func (c *Context) stopped() bool {
+	return c.ctx.Err() != nil || !c.resumeAt.IsZero()
+}
+
+// env resolves the variables of the chat, zero if they're not set.
+func (c *Context) env() env {
+	lookup := c.strictEnv()
+	return func(name string) (value, error) {
+		v, err := lookup(name)
+		if _, ok := err.(unsetError); ok {
+			return float64(0), nil
+		}
+		return v, err
+	}
+}
+
+// strictEnv is like env but fails with an unsetError for the variables
+// which aren't set.
+func (c *Context) strictEnv() env {
+	return func(name string) (value, error) {
+		v, ok, err := getStatus(c.channel, c.story, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			return nil, unsetError(name)
+		}
+		return parseValue(v), nil
+	}
+}
+
+func (c *Context) scale(d time.Duration) time.Duration {
+	if c.speed > 0 {
+		return time.Duration(float64(d) / c.speed)
+	}
+	return d
+}
+
+// send delivers msg to the chat, returns false if the playback is canceled.
+func (c *Context) send(msg string) bool {
+	if c.silent > 0 {
+		return c.ctx.Err() == nil
+	}
+
+	return reply(c.ctx, c.msgch, msg)
+}
+
+// reply sends msg to msgch, returns false if ctx is done first.
+func reply(ctx context.Context, msgch chan<- string, msg string) bool {
+	select {
+	case msgch <- msg:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// sleep pauses the playback for d, returns false if it's canceled meanwhile.
+func (c *Context) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
 }
 
 // Node interface.
@@ -104,7 +199,12 @@ func (n *BaseNode) Parse(raw string) (int, error) {
 				node = newChoiseNode()
 			case strings.HasPrefix(raw[i:], ifPrefix):
 				node = newIfNode()
-			case strings.HasPrefix(raw[i:], elseifPrefix), strings.HasPrefix(raw[i:], elsePrefix), strings.HasPrefix(raw[i:], endifPrefix):
+			case strings.HasPrefix(raw[i:], silentlyPrefix):
+				node = newSilentlyNode()
+			case strings.HasPrefix(raw[i:], printPrefix), strings.HasPrefix(raw[i:], printVarPrefix):
+				node = newTextNode()
+			case strings.HasPrefix(raw[i:], elseifPrefix), strings.HasPrefix(raw[i:], elsePrefix), strings.HasPrefix(raw[i:], endifPrefix),
+				strings.HasPrefix(raw[i:], endsilentlyPrefix):
 				return i, nil
 			default:
 				node = newUnHandleCmdNode()
@@ -117,6 +217,13 @@ func (n *BaseNode) Parse(raw string) (int, error) {
 		if err != nil {
 			return 0, err
 		}
+		if k <= 0 {
+			line := raw[i:]
+			if j := strings.IndexByte(line, '\n'); j >= 0 {
+				line = line[:j]
+			}
+			return 0, fmt.Errorf("can't parse %q", line)
+		}
 
 		n.AddChild(node)
 		i += k
@@ -157,6 +264,9 @@ func (n *BaseNode) Eval(ctx *Context) Node {
 
 func (n *BaseNode) Play(ctx *Context) {
 	for _, child := range n.children {
+		if ctx.stopped() {
+			return
+		}
 		child.Play(ctx)
 	}
 }
@@ -197,7 +307,7 @@ func newSectionNode() *SectionNode {
 func (n *SectionNode) Parse(raw string) (int, error) {
 	i := len(sectionPrefix)
 	section := lineRemain(raw[i:])
-	n.content = strings.TrimSpace(section)
+	n.content = sectionName(section)
 
 	i += len(section)
 	k, err := n.BaseNode.Parse(raw[i:])
@@ -208,6 +318,19 @@ func (n *SectionNode) Parse(raw string) (int, error) {
 	return i + k, nil
 }
 
+// sectionName returns the name of a section header, without the tags and
+// the metadata of Twee 3, e.g. "Start [tag] {"position":"100,100"}".
+func sectionName(header string) string {
+	name := strings.TrimSpace(header)
+	if i := strings.Index(name, " {"); i >= 0 && strings.HasSuffix(name, "}") {
+		name = strings.TrimSpace(name[:i])
+	}
+	if i := strings.Index(name, " ["); i >= 0 && strings.HasSuffix(name, "]") {
+		name = strings.TrimSpace(name[:i])
+	}
+	return name
+}
+
 func (n *SectionNode) Eval(ctx *Context) Node {
 	return n
 }
@@ -223,19 +346,137 @@ func newTextNode() *TextNode {
 	}
 }
 
+// printLen returns the length of the print macro raw starts with, zero if
+// it doesn't.
+func printLen(raw string) (int, error) {
+	if !strings.HasPrefix(raw, printPrefix) && !strings.HasPrefix(raw, printVarPrefix) {
+		return 0, nil
+	}
+
+	k := strings.Index(raw, cmdEndPrefix)
+	if k < 0 {
+		return 0, fmt.Errorf("can't find print end tag")
+	}
+	return k + len(cmdEndPrefix), nil
+}
+
 func (n *TextNode) Parse(raw string) (int, error) {
-	s := lineRemain(raw)
-	n.content = s
-	return len(s), nil
+	var i int
+	for {
+		i += len(lineRemain(raw[i:]))
+		k, err := printLen(raw[i:])
+		if err != nil {
+			return 0, err
+		}
+		if k == 0 {
+			break
+		}
+
+		_, err = printExpr(raw[i : i+k])
+		if err != nil {
+			return 0, err
+		}
+		i += k
+	}
+
+	n.content = raw[:i]
+	return i, nil
 }
 
 func (n *TextNode) Eval(ctx *Context) Node {
 	return n
 }
 
+// printExpr returns the expression of a print macro, e.g. <<print $a + 1>>
+// or <<$a>>.
+func printExpr(macro string) (expr, error) {
+	exp := strings.TrimSpace(macro[len(cmdPrefix) : len(macro)-len(cmdEndPrefix)])
+	return parseExpr(strings.TrimPrefix(exp, "print"))
+}
+
+// interpolate replaces the print macros and the variables of text with
+// their values.
+func interpolate(ctx *Context, text string) string {
+	return inlineExpr.ReplaceAllStringFunc(text, func(s string) string {
+		var x expr = &variable{strings.TrimPrefix(s, "$")}
+		if strings.HasPrefix(s, cmdPrefix) {
+			var err error
+			x, err = printExpr(s)
+			if err != nil {
+				return s
+			}
+		}
+
+		// the references to unset variables are left as they are.
+		v, err := x.eval(ctx.strictEnv())
+		if _, ok := err.(unsetError); ok {
+			return s
+		}
+
+		if err != nil {
+			log.Printf("Error: play print failed, %v\n", err)
+			return s
+		}
+		return formatValue(v)
+	})
+}
+
 func (n *TextNode) Play(ctx *Context) {
-	ctx.msgch <- n.Content()
-	time.Sleep(time.Second * 3)
+	if ctx.silent > 0 {
+		return
+	}
+
+	if ctx.send(interpolate(ctx, n.Content())) {
+		ctx.sleep(time.Second * 3)
+	}
+}
+
+// SilentlyNode def.
+type SilentlyNode struct {
+	*BaseNode
+}
+
+func newSilentlyNode() *SilentlyNode {
+	return &SilentlyNode{
+		newBaseNode("SilentlyNode"),
+	}
+}
+
+func (n *SilentlyNode) Parse(raw string) (int, error) {
+	k := strings.Index(raw, cmdEndPrefix)
+	if k < 0 {
+		return 0, fmt.Errorf("can't find cmd-silently end tag")
+	}
+
+	i := k + len(cmdEndPrefix)
+	k, err := n.BaseNode.Parse(raw[i:])
+	if err != nil {
+		return 0, err
+	}
+
+	i += k
+	if !strings.HasPrefix(raw[i:], endsilentlyPrefix) {
+		return 0, fmt.Errorf("can't find cmd-endsilently tag")
+	}
+
+	k = strings.Index(raw[i:], cmdEndPrefix)
+	if k < 0 {
+		return 0, fmt.Errorf("can't find cmd-endsilently end tag")
+	}
+	return i + k + len(cmdEndPrefix), nil
+}
+
+func (n *SilentlyNode) Eval(ctx *Context) Node {
+	return n
+}
+
+func (n *SilentlyNode) Play(ctx *Context) {
+	ctx.silent++
+	defer func() {
+		ctx.silent--
+	}()
+
+	n.BaseNode.Play(ctx)
 }
 
 // JumpNode def.
@@ -305,8 +546,14 @@ func (n *JumpNode) Eval(ctx *Context) Node {
 }
 
 func (n *JumpNode) Play(ctx *Context) {
-	if n.delay > 0 {
-		time.Sleep(time.Second * 10)
+	delay := ctx.scale(n.delay)
+	switch {
+	case delay > inlineDelay:
+		ctx.resumeAt = time.Now().Add(delay)
+	case delay > 0:
+		if !ctx.sleep(delay) {
+			return
+		}
 	}
 	ctx.currentSection = n.target
 }
@@ -315,7 +562,7 @@ func (n *JumpNode) Play(ctx *Context) {
 type SetNode struct {
 	*BaseNode
 	key   string
-	value []string
+	value expr
 }
 
 func newSetNode() *SetNode {
@@ -324,6 +571,12 @@ func newSetNode() *SetNode {
 	}
 }
 
+// assignments maps the assignment operators to the operator applied to the
+// variable, if any.
+var assignments = []struct{ op, binary string }{
+	{"+=", "+"}, {"-=", "-"}, {"*=", "*"}, {"/=", "/"}, {"=", ""}, {" to ", ""},
+}
+
 func (n *SetNode) Parse(raw string) (int, error) {
 	k := strings.Index(raw, cmdEndPrefix)
 	if k < 0 {
@@ -331,26 +584,33 @@ func (n *SetNode) Parse(raw string) (int, error) {
 	}
 
 	exp := strings.TrimSpace(raw[len(setPrefix):k])
-	exps := strings.Split(exp, "=")
-	if len(exps) != 2 {
-		return 0, fmt.Errorf("invalid cmd-set format: %s", exp)
+	i, op, binaryOp := -1, "", ""
+	for _, a := range assignments {
+		j := strings.Index(exp, a.op)
+		if j >= 0 && (i < 0 || j < i) {
+			i, op, binaryOp = j, a.op, a.binary
+		}
 	}
 
-	key := strings.TrimSpace(exps[0])
-	if !strings.HasPrefix(key, "$") {
+	if i < 0 {
 		return 0, fmt.Errorf("invalid cmd-set format: %s", exp)
 	}
 
-	key = key[1:]
-
-	value := strings.TrimSpace(exps[1])
-	valueExps := strings.Split(value, " ")
-	if len(valueExps)%2 != 1 {
+	key := strings.TrimSpace(exp[:i])
+	if len(key) < 2 || key[0] != '$' || strings.ContainsAny(key, " \t") {
 		return 0, fmt.Errorf("invalid cmd-set format: %s", exp)
 	}
 
-	n.key = key
-	n.value = valueExps
+	value, err := parseExpr(exp[i+len(op):])
+	if err != nil {
+		return 0, err
+	}
+
+	n.key = key[1:]
+	n.value = value
+	if len(binaryOp) > 0 {
+		n.value = &binary{binaryOp, &variable{n.key}, value}
+	}
 	return k + len(cmdEndPrefix), nil
 }
 
@@ -358,60 +618,14 @@ func (n *SetNode) Eval(ctx *Context) Node {
 	return n
 }
 
-func calculate(channel string, exps []string) (string, error) {
-	var (
-		value string
-		op    string
-	)
-
-	for _, exp := range exps {
-		switch exp {
-		case "+", "-", "*", "/":
-			op = exp
-		default:
-			v := exp
-			if strings.HasPrefix(v, "$") {
-				v, _ = getStatus(channel, v[1:])
-			}
-
-			if len(op) > 0 {
-				v1, err := strconv.Atoi(value)
-				if err != nil {
-					return "", fmt.Errorf("invalid caculate expression: %s", strings.Join(exps, " "))
-				}
-
-				v2, err := strconv.Atoi(v)
-				if err != nil {
-					return "", fmt.Errorf("invalid caculate expression: %s", strings.Join(exps, " "))
-				}
-
-				switch op {
-				case "+":
-					value = strconv.Itoa(v1 + v2)
-				case "-":
-					value = strconv.Itoa(v1 - v2)
-				case "*":
-					value = strconv.Itoa(v1 * v2)
-				case "/":
-					value = strconv.Itoa(v1 / v2)
-				}
-				op = ""
-			} else {
-				value = v
-			}
-		}
-	}
-	return value, nil
-}
-
 func (n *SetNode) Play(ctx *Context) {
-	value, err := calculate(ctx.channel, n.value)
+	value, err := n.value.eval(ctx.env())
 	if err != nil {
 		log.Printf("Error: play cmd-set failed, %v\n", err)
 		return
 	}
 
-	setStatus(ctx.channel, n.key, value)
+	setStatus(ctx.channel, ctx.story, n.key, formatValue(value))
 }
 
 // ChoiseNode def.
@@ -468,18 +682,21 @@ func (n *ChoiseNode) Eval(ctx *Context) Node {
 }
 
 func (n *ChoiseNode) Play(ctx *Context) {
-	ctx.msgch <- "--------------"
+	if !ctx.send("--------------") {
+		return
+	}
+
 	for i, child := range n.children {
-		ctx.msgch <- fmt.Sprintf("%d. %s", i+1, child.Content())
+		if !ctx.send(fmt.Sprintf("%d. %s", i+1, child.Content())) {
+			return
+		}
 	}
 }
 
 // ConditionNode def.
 type ConditionNode struct {
 	*BaseNode
-	left  string
-	op    string
-	right []string
+	cond expr
 }
 
 func newConditionNode() *ConditionNode {
@@ -525,55 +742,27 @@ func (n *ConditionNode) parseCondition(raw string) (int, error) {
 
 	exp := strings.TrimSpace(raw[:k])
 	if len(exp) > 0 {
-		exps := strings.Split(exp, " ")
-		if len(exps) < 3 || !(exps[1] == "is" || exps[1] == "eq" || exps[1] == "gte") {
-			return 0, fmt.Errorf("invalid condition format: %s", exp)
+		cond, err := parseExpr(exp)
+		if err != nil {
+			return 0, err
 		}
-
-		n.left = exps[0]
-		n.op = exps[1]
-		n.right = exps[2:]
+		n.cond = cond
 	}
 	return k + len(cmdEndPrefix), nil
 }
 
 func (n *ConditionNode) Eval(ctx *Context) Node {
-	if len(n.left) == 0 {
+	if n.cond == nil {
 		return n.Child(0).Eval(ctx)
 	}
 
-	l, err := calculate(ctx.channel, []string{n.left})
-	if err != nil {
-		log.Printf("Error: invalid condition left format: %s\n", n.left)
-		return nilNode
-	}
-
-	r, err := calculate(ctx.channel, n.right)
+	v, err := n.cond.eval(ctx.env())
 	if err != nil {
-		log.Printf("Error: invalid condition right format: %s\n", strings.Join(n.right, " "))
+		log.Printf("Error: eval condition failed, %v\n", err)
 		return nilNode
 	}
 
-	var is bool
-	switch n.op {
-	case "is", "eq":
-		is = (l == r)
-	case "gte":
-		lInt, err := strconv.Atoi(l)
-		if err != nil {
-			log.Printf("Error: invalid condition left format for op=%s: %s\n", n.op, n.left)
-			return nilNode
-		}
-
-		rInt, err := strconv.Atoi(r)
-		if err != nil {
-			log.Printf("Error: invalid condition right format for op=%s: %s\n", n.op, strings.Join(n.right, " "))
-			return nilNode
-		}
-		is = (lInt >= rInt)
-	}
-
-	if is {
+	if truthy(v) {
 		return n.Child(0).Eval(ctx)
 	}
 
@@ -0,0 +1,64 @@
+package lifeline
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseUnterminated(t *testing.T) {
+	for _, raw := range []string{
+		":: Start\nhello <<print $a",
+		":: Start\nhello <<$a",
+		":: Start\n<<print $a",
+		":: Start\n<<$a\n:: End\nbye",
+		":: Start\n<<set $a = 1",
+		":: Start\n[[End",
+		":: Start\n<<if $a is 1>>yes",
+		":: Start\n<<silently>><<set $a = 1>>",
+	} {
+		done := make(chan error)
+		go func() {
+			_, err := newBaseNode("").Parse(raw)
+			done <- err
+		}()
+
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Errorf("parse %q: expected an error", raw)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("parse %q: didn't return", raw)
+		}
+	}
+}
+
+func TestParsePrint(t *testing.T) {
+	st := newStory(":: Start\nhello <<print $a + 1>> and <<$b>>\n")
+	if err := st.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	text, ok := st.sections[startSection].Child(0).(*TextNode)
+	if !ok || text.Content() != "hello <<print $a + 1>> and <<$b>>" {
+		t.Fatalf("unexpected text node %v", st.sections[startSection].Child(0))
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	ctx := testContext(t, map[string]string{"a": "3", "power": "pod"})
+
+	for _, c := range []struct {
+		text string
+		want string
+	}{
+		{"$power has <<print $a + 1>> and <<$a>>", "pod has 4 and 3"},
+		{"costs $5", "costs $5"},
+		{"$unset and <<$unset>>", "$unset and <<$unset>>"},
+		{"<<print $unset + 1>> then $a", "<<print $unset + 1>> then 3"},
+	} {
+		if got := interpolate(ctx, c.text); got != c.want {
+			t.Errorf("interpolate %q: got %q, want %q", c.text, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package lifeline
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-chat-bot/bot"
+	"github.com/tidyoux/chatbot/plugins"
+)
+
+const (
+	resumeInterval = 5 * time.Second
+
+	// inlineDelay is the longest delay waited for during the playback, the
+	// longer ones resuming it later.
+	inlineDelay = 10 * time.Second
+)
+
+var (
+	startOnce sync.Once
+)
+
+// play plays the story of the chat, or its reply to ctx.data, then saves
+// where it stopped and when it should resume.
+func play(ctx *Context) error {
+	story, ok := getStory(ctx.story)
+	if !ok {
+		return fmt.Errorf("unknown story %s", ctx.story)
+	}
+
+	var err error
+	if len(ctx.data) > 0 {
+		err = story.Reply(ctx)
+	} else {
+		err = story.Play(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = setSection(ctx.channel, ctx.story, ctx.currentSection)
+	if err != nil || ctx.resumeAt.IsZero() {
+		return err
+	}
+	return setResume(ctx.channel, ctx.story, ctx.resumeAt)
+}
+
+// Start starts resuming the stories whose delays elapsed, pushing their
+// messages to the chats.
+func Start() {
+	startOnce.Do(func() {
+		go func() {
+			for now := range time.Tick(resumeInterval) {
+				err := resumeDue(now)
+				if err != nil {
+					log.Println(namespace, err)
+				}
+			}
+		}()
+	})
+}
+
+func resumeDue(now time.Time) error {
+	due, err := dueResumes(now)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range due {
+		channel, name := d[0], d[1]
+
+		// the stories the chat doesn't play wait until it's back to them.
+		current, err := getStoryName(channel)
+		if err != nil {
+			return err
+		}
+
+		if current != name || !getLock(channel) {
+			continue
+		}
+
+		err = deleteResume(channel, name)
+		if err != nil {
+			releaseLock(channel)
+			return err
+		}
+
+		plugins.Go(&bot.Cmd{Channel: channel, Command: "lifeline"}, func() {
+			defer releaseLock(channel)
+
+			err := resume(channel, name)
+			if err != nil {
+				log.Println(namespace, err)
+			}
+		})
+	}
+	return nil
+}
+
+func resume(channel string, story string) error {
+	section, err := getSection(channel, story)
+	if err != nil {
+		return err
+	}
+
+	speed, err := getSpeed(channel)
+	if err != nil {
+		return err
+	}
+
+	msgch := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg := range msgch {
+			plugins.Send(channel, msg)
+		}
+	}()
+
+	err = play(&Context{
+		ctx:            plugins.Background(),
+		channel:        channel,
+		story:          story,
+		currentSection: section,
+		speed:          speed,
+		msgch:          msgch,
+	})
+	close(msgch)
+	<-done
+	return err
+}
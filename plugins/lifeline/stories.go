@@ -0,0 +1,97 @@
+package lifeline
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tidyoux/chatbot/plugins/lifeline/data"
+)
+
+const (
+	// defaultStory is the name of the built-in story, played by the chats
+	// which didn't pick any.
+	defaultStory = "lifeline"
+)
+
+var (
+	// storyExts are the extensions of the Twee source files.
+	storyExts = map[string]bool{
+		".tw":   true,
+		".twee": true,
+	}
+
+	storiesMu sync.RWMutex
+	stories   = make(map[string]*Story)
+)
+
+func addStory(name string, raw string) error {
+	st := newStory(raw)
+	err := st.Init()
+	if err != nil {
+		return fmt.Errorf("init story %s failed, %v", name, err)
+	}
+
+	storiesMu.Lock()
+	stories[name] = st
+	storiesMu.Unlock()
+	return nil
+}
+
+// LoadStories loads the Twee stories of dir, named after their files. The
+// stories failing to parse are logged and skipped.
+func LoadStories(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		ext := strings.ToLower(filepath.Ext(f.Name()))
+		if f.IsDir() || !storyExts[ext] {
+			continue
+		}
+
+		raw, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return err
+		}
+
+		err = addStory(strings.TrimSuffix(f.Name(), filepath.Ext(f.Name())), string(raw))
+		if err != nil {
+			log.Println(namespace, err)
+		}
+	}
+	return nil
+}
+
+func getStory(name string) (*Story, bool) {
+	storiesMu.RLock()
+	defer storiesMu.RUnlock()
+
+	st, ok := stories[name]
+	return st, ok
+}
+
+func storyNames() []string {
+	storiesMu.RLock()
+	defer storiesMu.RUnlock()
+
+	names := make([]string, 0, len(stories))
+	for name := range stories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	err := addStory(defaultStory, data.Story)
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+	}
+}
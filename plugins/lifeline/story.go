@@ -1,6 +1,7 @@
 package lifeline
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -8,10 +9,16 @@ import (
 
 const (
 	startSection = "Start"
+
+	// the special passages of Twee stories.
+	titlePassage = "StoryTitle"
+	dataPassage  = "StoryData"
 )
 
 type Story struct {
 	raw      string
+	title    string
+	start    string
 	rootNode Node
 	sections map[string]Node
 }
@@ -42,9 +49,35 @@ func (st *Story) Init() error {
 		return fmt.Errorf("parsed section count mismatch, got %d, total: %d", len(st.sections), sectionCount)
 	}
 
+	st.title = passage(st.raw, titlePassage)
+
+	var data struct {
+		Start string `json:"start"`
+	}
+	st.start = startSection
+	if json.Unmarshal([]byte(passage(st.raw, dataPassage)), &data) == nil && len(data.Start) > 0 {
+		st.start = data.Start
+	}
+
+	if _, ok := st.sections[st.start]; !ok {
+		return fmt.Errorf("can't find start section %s", st.start)
+	}
+
 	return nil
 }
 
+// passage returns the text of the passage named name, empty if missing.
+func passage(raw string, name string) string {
+	passages := strings.Split("\n"+raw, "\n"+sectionPrefix)
+	for _, p := range passages[1:] {
+		header := lineRemain(p)
+		if sectionName(header) == name {
+			return strings.TrimSpace(p[len(header):])
+		}
+	}
+	return ""
+}
+
 func (st *Story) Play(ctx *Context) error {
 	section, ok := st.sections[ctx.currentSection]
 	if !ok {
@@ -53,7 +86,11 @@ func (st *Story) Play(ctx *Context) error {
 
 	start := ctx.currentSection
 	section.Play(ctx)
-	if ctx.currentSection != start {
+	if err := ctx.ctx.Err(); err != nil {
+		return err
+	}
+
+	if ctx.currentSection != start && ctx.resumeAt.IsZero() {
 		return st.Play(ctx)
 	}
 	return nil
@@ -84,7 +121,11 @@ func (st *Story) Reply(ctx *Context) error {
 
 	start := ctx.currentSection
 	node.Play(ctx)
-	if ctx.currentSection != start {
+	if err := ctx.ctx.Err(); err != nil {
+		return err
+	}
+
+	if ctx.currentSection != start && ctx.resumeAt.IsZero() {
 		return st.Play(ctx)
 	}
 	return nil
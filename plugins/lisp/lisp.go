@@ -1,16 +1,28 @@
 package lisp
 
 import (
+	"context"
 	"strings"
 
 	"github.com/glycerine/zygomys/zygo"
 	"github.com/go-chat-bot/bot"
+	"github.com/tidyoux/chatbot/plugins"
 )
 
-func lisp(command *bot.Cmd) (string, error) {
-	code := strings.Join(command.Args, " ")
-	env := zygo.NewZlispSandbox()
-	err := env.LoadString(code)
+// halted is panicked by the interpreter hook to abort a canceled run.
+type halted struct{}
+
+func run(ctx context.Context, env *zygo.Zlisp, code string) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(halted); !ok {
+				panic(r)
+			}
+			err = ctx.Err()
+		}
+	}()
+
+	err = env.LoadString(code)
 	if err != nil {
 		return "", err
 	}
@@ -22,8 +34,22 @@ func lisp(command *bot.Cmd) (string, error) {
 	return expr.SexpString(nil), nil
 }
 
+func lisp(ctx context.Context, command *bot.Cmd) (string, error) {
+	code := strings.Join(command.Args, " ")
+	env := zygo.NewZlispSandbox()
+	defer env.Stop()
+
+	// every function call checks for cancellation, which bounds loops.
+	env.AddPreHook(func(*zygo.Zlisp, string, []zygo.Sexp) {
+		if ctx.Err() != nil {
+			panic(halted{})
+		}
+	})
+	return run(ctx, env, code)
+}
+
 func init() {
-	bot.RegisterCommand(
+	plugins.RegisterCommand(
 		"lisp",
 		"Runs a lisp code.",
 		"'(+ 1 1)'",
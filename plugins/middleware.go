@@ -0,0 +1,50 @@
+package plugins
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/go-chat-bot/bot"
+)
+
+// Invocation describes a finished command execution.
+type Invocation struct {
+	Cmd      *bot.Cmd
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// Observer is notified of command executions.
+type Observer func(inv *Invocation)
+
+// Observe returns a middleware notifying o of every command executed.
+func Observe(o Observer) Middleware {
+	return func(next CmdFunc) CmdFunc {
+		return func(ctx context.Context, cmd *bot.Cmd) (string, error) {
+			start := time.Now()
+			msg, err := next(ctx, cmd)
+			o(&Invocation{
+				Cmd:      cmd,
+				Start:    start,
+				Duration: time.Since(start),
+				Err:      err,
+			})
+			return msg, err
+		}
+	}
+}
+
+// Logger returns a middleware logging every command executed.
+func Logger() Middleware {
+	return Observe(func(inv *Invocation) {
+		var user string
+		if inv.Cmd.User != nil {
+			user = inv.Cmd.User.ID
+		}
+
+		log.Printf("Command %s in chat %s by %s, args: %s, took %v, err: %v\n",
+			inv.Cmd.Command, inv.Cmd.Channel, user, inv.Cmd.RawArgs, inv.Duration, inv.Err)
+	})
+}
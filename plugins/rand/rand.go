@@ -1,11 +1,13 @@
 package rand
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"strconv"
 
 	"github.com/go-chat-bot/bot"
+	"github.com/tidyoux/chatbot/plugins"
 )
 
 func getSpan(args []string) (from, to int) {
@@ -35,13 +37,13 @@ func getSpan(args []string) (from, to int) {
 	return r, l
 }
 
-func random(command *bot.Cmd) (msg string, err error) {
+func random(_ context.Context, command *bot.Cmd) (msg string, err error) {
 	from, to := getSpan(command.Args)
 	return fmt.Sprint(from + rand.Intn(to-from)), nil
 }
 
 func init() {
-	bot.RegisterCommand(
+	plugins.RegisterCommand(
 		"rand",
 		"Returns a pseudo-random number in [a, b)",
 		"0 100",
@@ -0,0 +1,68 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime/debug"
+	"sync"
+
+	"github.com/go-chat-bot/bot"
+)
+
+// InternalError is replied when a command fails unexpectedly.
+const InternalError = "internal error"
+
+var (
+	errInternal = errors.New(InternalError)
+
+	panicsMu sync.Mutex
+	panics   = make(map[string]int)
+)
+
+// PanicCount returns how many times command has panicked.
+func PanicCount(command string) int {
+	panicsMu.Lock()
+	defer panicsMu.Unlock()
+	return panics[command]
+}
+
+func recovered(cmd *bot.Cmd, r interface{}) error {
+	panicsMu.Lock()
+	panics[cmd.Command]++
+	count := panics[cmd.Command]
+	panicsMu.Unlock()
+
+	log.Printf("Error: command %s panicked in chat %s (%d times), args: %s, %v\n%s",
+		cmd.Command, cmd.Channel, count, cmd.RawArgs, r, debug.Stack())
+	return errInternal
+}
+
+// Recover returns a middleware recovering from the panics of commands, which
+// are logged and replied as an internal error instead of crashing the bot.
+func Recover() Middleware {
+	return func(next CmdFunc) CmdFunc {
+		return func(ctx context.Context, cmd *bot.Cmd) (msg string, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					msg, err = "", recovered(cmd, r)
+				}
+			}()
+			return next(ctx, cmd)
+		}
+	}
+}
+
+// Go runs f in a new goroutine on behalf of cmd, so that a panic in it is
+// logged and reported to the chat instead of crashing the bot.
+func Go(cmd *bot.Cmd, f func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				recovered(cmd, r)
+				Send(cmd.Channel, InternalError)
+			}
+		}()
+		f()
+	}()
+}
@@ -0,0 +1,34 @@
+package schedule
+
+import (
+	"github.com/tidyoux/chatbot/db"
+)
+
+const (
+	namespace = "schedule"
+
+	schedulesKey = "schedules"
+	lastIDKey    = "lastid"
+)
+
+var (
+	dbInstance = db.New(namespace)
+)
+
+func loadSchedules() (map[int]*Schedule, error) {
+	schedules := make(map[int]*Schedule)
+	_, err := dbInstance.GetJSON([]byte(schedulesKey), &schedules)
+	if err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func saveSchedules(schedules map[int]*Schedule) error {
+	return dbInstance.SetJSON([]byte(schedulesKey), schedules)
+}
+
+func nextID() (int, error) {
+	id, err := dbInstance.Incr([]byte(lastIDKey), 1)
+	return int(id), err
+}
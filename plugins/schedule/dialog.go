@@ -0,0 +1,93 @@
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/go-chat-bot/bot"
+	"github.com/tidyoux/chatbot/plugins"
+)
+
+const (
+	scheduleDialog = "schedule"
+
+	specStep    = "spec"
+	commandStep = "command"
+
+	specData    = "spec"
+	channelData = "channel"
+	userData    = "user"
+
+	askSpec    = "Cron spec? e.g. 0 8 * * *, or TZ=Asia/Shanghai 0 8 * * *"
+	askCommand = "Command to run? e.g. weather beijing"
+)
+
+// startWizard asks the user for the spec and the command of a schedule, one
+// after the other.
+func startWizard(command *bot.Cmd) (string, error) {
+	channel, err := json.Marshal(command.ChannelData)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := json.Marshal(command.User)
+	if err != nil {
+		return "", err
+	}
+
+	return plugins.StartDialog(scheduleDialog, command.Channel, command.User.ID, map[string]string{
+		channelData: string(channel),
+		userData:    string(user),
+	})
+}
+
+func answerCommand(s *plugins.Session, answer string) (string, string, error) {
+	var channel bot.ChannelData
+	err := json.Unmarshal([]byte(s.Data[channelData]), &channel)
+	if err != nil {
+		return "", "", err
+	}
+
+	var user bot.User
+	err = json.Unmarshal([]byte(s.Data[userData]), &user)
+	if err != nil {
+		return "", "", err
+	}
+
+	msg, err := addSchedule(s.Data[specData], answer, &channel, &user)
+	return msg, "", err
+}
+
+func init() {
+	plugins.RegisterDialog(&plugins.Dialog{
+		Name:  scheduleDialog,
+		Start: specStep,
+		Steps: map[string]*plugins.Step{
+			specStep: {
+				Prompt: func(*plugins.Session) string {
+					return askSpec
+				},
+				Validate: func(_ *plugins.Session, answer string) error {
+					_, err := parseSpec(answer)
+					return err
+				},
+				Answer: func(s *plugins.Session, answer string) (string, string, error) {
+					s.Data[specData] = answer
+					return "", commandStep, nil
+				},
+			},
+			commandStep: {
+				Prompt: func(*plugins.Session) string {
+					return askCommand
+				},
+				Validate: func(_ *plugins.Session, answer string) error {
+					if len(commandText(answer)) == 0 {
+						return errors.New(plugins.InvalidParams)
+					}
+					return nil
+				},
+				Answer: answerCommand,
+			},
+		},
+	})
+}
@@ -0,0 +1,195 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/go-chat-bot/bot"
+	"github.com/tidyoux/chatbot/plugins"
+)
+
+const (
+	scheduleCommand = "schedule"
+
+	success          = "status:ok"
+	scheduleAdded    = "schedule %d added, next run at %s"
+	scheduleNotFound = "schedule %d not found"
+	noSchedules      = "no schedules"
+)
+
+var (
+	// storeMu serializes the read-modify-write of the schedule table.
+	storeMu sync.Mutex
+)
+
+// commandText returns the command text scheduled, without its prefix,
+// empty if it can't be scheduled.
+func commandText(text string) string {
+	text = strings.TrimPrefix(strings.TrimSpace(text), bot.CmdPrefix)
+	if len(text) == 0 || strings.Fields(text)[0] == scheduleCommand {
+		return ""
+	}
+	return text
+}
+
+// rawTail returns raw without its first shell word, the spec, keeping the
+// quoting of the command intact.
+func rawTail(raw string) string {
+	raw = strings.TrimSpace(raw)
+
+	var quote rune
+	escaped := false
+	for i, r := range raw {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case unicode.IsSpace(r):
+			return strings.TrimSpace(raw[i:])
+		}
+	}
+	return ""
+}
+
+func add(command *bot.Cmd) (string, error) {
+	return addSchedule(command.Args[0], rawTail(command.RawArgs), command.ChannelData, command.User)
+}
+
+func addSchedule(spec, text string, channel *bot.ChannelData, user *bot.User) (string, error) {
+	text = commandText(text)
+	if len(text) == 0 {
+		return plugins.InvalidParams, nil
+	}
+
+	sched, err := parseSpec(spec)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err), nil
+	}
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	schedules, err := loadSchedules()
+	if err != nil {
+		return "", err
+	}
+
+	id, err := nextID()
+	if err != nil {
+		return "", err
+	}
+
+	schedules[id] = &Schedule{
+		ID:      id,
+		Spec:    spec,
+		Command: text,
+		Channel: channel,
+		User:    user,
+	}
+	err = saveSchedules(schedules)
+	if err != nil {
+		return "", err
+	}
+
+	reload(schedules)
+	return fmt.Sprintf(scheduleAdded, id, sched.Next(time.Now()).Format(time.RFC1123)), nil
+}
+
+func list(channel string) (string, error) {
+	schedules, err := loadSchedules()
+	if err != nil {
+		return "", err
+	}
+
+	var ids []int
+	for id, s := range schedules {
+		if s.Channel.Channel == channel {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		return noSchedules, nil
+	}
+
+	sort.Ints(ids)
+	var lines []string
+	for _, id := range ids {
+		s := schedules[id]
+		lines = append(lines, fmt.Sprintf("%d. \"%s\" %s", s.ID, s.Spec, s.Command))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func remove(channel string, id int) (string, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	schedules, err := loadSchedules()
+	if err != nil {
+		return "", err
+	}
+
+	s, ok := schedules[id]
+	if !ok || s.Channel.Channel != channel {
+		return fmt.Sprintf(scheduleNotFound, id), nil
+	}
+
+	delete(schedules, id)
+	err = saveSchedules(schedules)
+	if err != nil {
+		return "", err
+	}
+
+	reload(schedules)
+	return success, nil
+}
+
+func schedule(_ context.Context, command *bot.Cmd) (string, error) {
+	if len(command.Args) < 1 {
+		return plugins.InvalidAmountOfParams, nil
+	}
+
+	switch command.Args[0] {
+	case "new":
+		return startWizard(command)
+	case "list":
+		return list(command.Channel)
+	case "rm":
+		if len(command.Args) != 2 {
+			return plugins.InvalidAmountOfParams, nil
+		}
+
+		id, err := strconv.Atoi(command.Args[1])
+		if err != nil {
+			return plugins.InvalidParams, nil
+		}
+		return remove(command.Channel, id)
+	default:
+		if len(command.Args) < 2 {
+			return plugins.InvalidAmountOfParams, nil
+		}
+		return add(command)
+	}
+}
+
+func init() {
+	plugins.RegisterCommand(
+		scheduleCommand,
+		"Runs a command in this chat on a cron spec, optionally prefixed by TZ=<location>.",
+		"\"0 8 * * *\" weather beijing (or, new, or, list, or, rm 1)",
+		schedule)
+}
@@ -0,0 +1,141 @@
+package schedule
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chat-bot/bot"
+	"github.com/robfig/cron"
+	"github.com/tidyoux/chatbot/plugins"
+)
+
+const (
+	tzPrefix = "TZ="
+)
+
+// Schedule is a command run periodically in the chat which created it.
+type Schedule struct {
+	ID      int
+	Spec    string
+	Command string
+	Channel *bot.ChannelData
+	User    *bot.User
+}
+
+// Dispatcher delivers a scheduled command message to the bot as if the
+// user had sent it to the chat.
+type Dispatcher func(channel *bot.ChannelData, text string, user *bot.User)
+
+// tzSchedule evaluates a cron schedule in a fixed time zone.
+type tzSchedule struct {
+	cron.Schedule
+	location *time.Location
+}
+
+func (s tzSchedule) Next(t time.Time) time.Time {
+	return s.Schedule.Next(t.In(s.location))
+}
+
+var (
+	mu         sync.Mutex
+	dispatch   Dispatcher
+	cronRunner *cron.Cron
+)
+
+// parseSpec parses a standard 5 field cron spec, optionally prefixed by
+// TZ=<location>, e.g. "TZ=Asia/Shanghai 0 8 * * *".
+func parseSpec(spec string) (cron.Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	location := time.Local
+	if strings.HasPrefix(spec, tzPrefix) {
+		k := strings.Index(spec, " ")
+		if k < 0 {
+			return nil, fmt.Errorf("invalid schedule spec: %s", spec)
+		}
+
+		var err error
+		location, err = time.LoadLocation(spec[len(tzPrefix):k])
+		if err != nil {
+			return nil, err
+		}
+		spec = strings.TrimSpace(spec[k:])
+	}
+
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, err
+	}
+	return tzSchedule{sched, location}, nil
+}
+
+func (s *Schedule) Run() {
+	mu.Lock()
+	d := dispatch
+	mu.Unlock()
+
+	if d != nil {
+		d(s.Channel, bot.CmdPrefix+s.Command, s.User)
+	}
+}
+
+// reload replaces the running cron with one holding the given schedules,
+// since cron entries can't be removed one by one.
+func reload(schedules map[int]*Schedule) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if dispatch == nil {
+		return
+	}
+
+	if cronRunner != nil {
+		cronRunner.Stop()
+	}
+
+	cronRunner = cron.New()
+	for _, s := range schedules {
+		sched, err := parseSpec(s.Spec)
+		if err != nil {
+			log.Printf("Error: invalid schedule %d, %v\n", s.ID, err)
+			continue
+		}
+		cronRunner.Schedule(sched, s)
+	}
+	cronRunner.Start()
+}
+
+// Start runs the persisted schedules, delivering their commands through d,
+// until plugins.Shutdown.
+func Start(d Dispatcher) error {
+	schedules, err := loadSchedules()
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	dispatch = d
+	mu.Unlock()
+
+	reload(schedules)
+
+	go func() {
+		<-plugins.Background().Done()
+		stop()
+	}()
+	return nil
+}
+
+// stop stops the cron, the schedules changed afterwards aren't run.
+func stop() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	dispatch = nil
+	if cronRunner != nil {
+		cronRunner.Stop()
+		cronRunner = nil
+	}
+}
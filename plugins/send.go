@@ -0,0 +1,34 @@
+package plugins
+
+import (
+	"log"
+	"sync"
+)
+
+// Sender delivers a message to a chat outside of a command reply.
+type Sender func(channel, message string)
+
+var (
+	senderMu sync.RWMutex
+	sender   Sender
+)
+
+// SetSender sets how Send delivers messages, normally to the running bot.
+func SetSender(s Sender) {
+	senderMu.Lock()
+	defer senderMu.Unlock()
+	sender = s
+}
+
+// Send delivers message to channel unprompted.
+func Send(channel, message string) {
+	senderMu.RLock()
+	s := sender
+	senderMu.RUnlock()
+
+	if s == nil {
+		log.Printf("Warning: no sender, drop message to %s\n", channel)
+		return
+	}
+	s(channel, message)
+}
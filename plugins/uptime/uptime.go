@@ -3,14 +3,16 @@
 package uptime
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/cloudfoundry/gosigar"
 	"github.com/go-chat-bot/bot"
+	"github.com/tidyoux/chatbot/plugins"
 )
 
-func uptime(command *bot.Cmd) (msg string, err error) {
+func uptime(_ context.Context, command *bot.Cmd) (msg string, err error) {
 	uptime := sigar.Uptime{}
 	uptime.Get()
 	avg := sigar.LoadAverage{}
@@ -21,7 +23,7 @@ func uptime(command *bot.Cmd) (msg string, err error) {
 }
 
 func init() {
-	bot.RegisterCommand(
+	plugins.RegisterCommand(
 		"uptime",
 		"Sends the uptime of your server to you on the channel.",
 		"",
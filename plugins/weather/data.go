@@ -1,8 +1,10 @@
 package weather
 
 import (
+	"context"
 	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/buger/jsonparser"
 	"github.com/tidyoux/chatbot/utils"
@@ -14,6 +16,8 @@ const (
 	apiURL = "https://free-api.heweather.com/s6/weather?key=" + apiKey + "&location="
 
 	success = "ok"
+
+	cacheTTL = 10 * time.Minute
 )
 
 var lifestyleTypes = map[string]string{
@@ -37,9 +41,9 @@ var lifestyleTypes = map[string]string{
 
 type WeatherData []byte
 
-func getWeatherData(location string) (WeatherData, error) {
+func getWeatherData(ctx context.Context, location string) (WeatherData, error) {
 	loc := url.QueryEscape(location)
-	data, err := utils.GetBody(apiURL + loc)
+	data, err := utils.GetBody(ctx, apiURL+loc, utils.WithCache(cacheTTL))
 	if err != nil {
 		return nil, err
 	}
@@ -1,18 +1,20 @@
 package weather
 
 import (
+	"context"
 	"strings"
 
 	"github.com/go-chat-bot/bot"
+	"github.com/tidyoux/chatbot/plugins"
 )
 
-func weather(command *bot.Cmd) (string, error) {
+func weather(ctx context.Context, command *bot.Cmd) (string, error) {
 	location := "beijing"
 	if len(command.Args) >= 1 && len(command.Args[0]) > 0 {
 		location = strings.Join(command.Args, " ")
 	}
 
-	weatherData, err := getWeatherData(location)
+	weatherData, err := getWeatherData(ctx, location)
 	if err != nil {
 		return "", err
 	}
@@ -21,7 +23,7 @@ func weather(command *bot.Cmd) (string, error) {
 }
 
 func init() {
-	bot.RegisterCommand(
+	plugins.RegisterCommand(
 		"weather",
 		"Searchs weather information",
 		"chaoyang,beijing",
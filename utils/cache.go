@@ -0,0 +1,224 @@
+package utils
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidyoux/chatbot/db"
+)
+
+const (
+	cacheNamespace = "httpcache"
+)
+
+type cacheEntry struct {
+	Key     string
+	Body    []byte
+	Expires time.Time
+}
+
+// lru is an in-memory cache of responses evicting the least recently used.
+type lru struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+func newLRU(capacity int) *lru {
+	return &lru{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *lru) get(key string, now time.Time) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	e := elem.Value.(*cacheEntry)
+	if !now.Before(e.Expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil
+	}
+
+	c.order.MoveToFront(elem)
+	return e
+}
+
+func (c *lru) set(e *cacheEntry) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[e.Key]; ok {
+		elem.Value = e
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[e.Key] = c.order.PushFront(e)
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).Key)
+	}
+}
+
+// call is a request in flight, shared by the identical ones made meanwhile.
+type call struct {
+	done chan struct{}
+	body []byte
+	err  error
+}
+
+var (
+	cacheDB = db.New(cacheNamespace)
+
+	memCache = newLRU(DefaultConfig().CacheSize)
+
+	callsMu sync.Mutex
+	calls   = make(map[string]*call)
+)
+
+func currentCache() *lru {
+	clientMu.RLock()
+	defer clientMu.RUnlock()
+	return memCache
+}
+
+// cacheKey returns the key url is cached under, hashed not to store the
+// secrets of its query, e.g. api keys.
+func cacheKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+func loadCached(key string, persist bool) []byte {
+	now := time.Now()
+	if e := currentCache().get(key, now); e != nil {
+		return e.Body
+	}
+
+	if !persist {
+		return nil
+	}
+
+	data, err := cacheDB.Get([]byte(key))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+
+	var e cacheEntry
+	err = json.Unmarshal(data, &e)
+	if err != nil || !now.Before(e.Expires) {
+		return nil
+	}
+
+	currentCache().set(&e)
+	return e.Body
+}
+
+func storeCached(e *cacheEntry, persist bool) {
+	currentCache().set(e)
+	if !persist {
+		return
+	}
+
+	data, err := json.Marshal(e)
+	if err == nil {
+		err = cacheDB.SetWithTTL([]byte(e.Key), data, time.Until(e.Expires))
+	}
+	if err != nil {
+		log.Println(cacheNamespace, err)
+	}
+}
+
+// cacheTTL returns how long a response may be cached given the ttl asked by
+// the caller, lowered to its Cache-Control max-age or to zero if it
+// forbids caching.
+func cacheTTL(header http.Header, ttl time.Duration) time.Duration {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store" || directive == "no-cache":
+			return 0
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(directive[len("max-age="):])
+			if err == nil && time.Duration(seconds)*time.Second < ttl {
+				ttl = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return ttl
+}
+
+// getCached returns the body of url from the cache, or fetches it through
+// fetch, sharing a single request between concurrent callers. The shared
+// request isn't canceled along with its callers, each waiting for it until
+// its own ctx is done.
+func getCached(ctx context.Context, url string, ttl time.Duration, fetch func(context.Context) ([]byte, http.Header, error)) ([]byte, error) {
+	_, cfg := current()
+	key := cacheKey(url)
+	if body := loadCached(key, cfg.PersistCache); body != nil {
+		return body, nil
+	}
+
+	callsMu.Lock()
+	c, ok := calls[key]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		calls[key] = c
+		go c.fetch(key, ttl, cfg.PersistCache, fetch)
+	}
+	callsMu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.body, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *call) fetch(key string, ttl time.Duration, persist bool, fetch func(context.Context) ([]byte, http.Header, error)) {
+	defer func() {
+		callsMu.Lock()
+		delete(calls, key)
+		callsMu.Unlock()
+		close(c.done)
+	}()
+
+	var header http.Header
+	c.body, header, c.err = fetch(context.Background())
+	if c.err != nil {
+		return
+	}
+
+	if ttl = cacheTTL(header, ttl); ttl > 0 {
+		storeCached(&cacheEntry{
+			Key:     key,
+			Body:    c.body,
+			Expires: time.Now().Add(ttl),
+		}, persist)
+	}
+}
@@ -1,23 +1,272 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 )
 
-func GetBody(url string) ([]byte, error) {
-	res, err := http.Get(url)
+// Config configures the HTTP client shared by plugins.
+type Config struct {
+	// Timeout bounds a whole request, including reading the body.
+	Timeout time.Duration
+
+	// MaxBodySize is the largest response body read, in bytes, zero for no
+	// limit.
+	MaxBodySize int64
+
+	// Retries is how many times an idempotent request is retried after a
+	// network error or a 5xx or 429 status, waiting Backoff at first and
+	// twice as long each time after.
+	Retries int
+	Backoff time.Duration
+
+	UserAgent string
+
+	// CacheSize is how many responses are kept in memory for the requests
+	// asking for caching, PersistCache also storing them in the db.
+	CacheSize    int
+	PersistCache bool
+
+	// Dial connects to the servers, e.g. through the bot's proxy. It may be
+	// nil to connect directly.
+	Dial func(network, addr string) (net.Conn, error)
+}
+
+// StatusError is returned for responses of a non 2xx status.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Method, redactURL(e.URL), e.Status)
+}
+
+// BodyLimitError is returned for responses whose body exceeds the
+// MaxBodySize of the configuration.
+type BodyLimitError struct {
+	Method string
+	URL    string
+	Limit  int64
+}
+
+func (e *BodyLimitError) Error() string {
+	return fmt.Sprintf("%s %s: response body exceeds %d bytes", e.Method, redactURL(e.URL), e.Limit)
+}
+
+// redactURL strips the query of rawurl, which may hold api keys, from the
+// errors shown to the users.
+func redactURL(rawurl string) string {
+	if i := strings.IndexAny(rawurl, "?#"); i >= 0 {
+		return rawurl[:i]
+	}
+	return rawurl
+}
+
+var (
+	clientMu sync.RWMutex
+	config   = DefaultConfig()
+	client   = newClient(config)
+)
+
+// DefaultConfig returns the configuration used unless Configure is called.
+func DefaultConfig() Config {
+	return Config{
+		Timeout:     15 * time.Second,
+		MaxBodySize: 4 << 20,
+		Retries:     2,
+		Backoff:     500 * time.Millisecond,
+		UserAgent:   "chatbot",
+		CacheSize:   256,
+	}
+}
+
+func newClient(cfg Config) *http.Client {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if cfg.Dial != nil {
+		transport.Proxy = nil
+		transport.Dial = cfg.Dial
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+	}
+}
+
+// Configure replaces the configuration of the shared client.
+func Configure(cfg Config) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+
+	config = cfg
+	client = newClient(cfg)
+	memCache = newLRU(cfg.CacheSize)
+}
+
+func current() (*http.Client, Config) {
+	clientMu.RLock()
+	defer clientMu.RUnlock()
+	return client, config
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func retryable(err error) bool {
+	switch e := err.(type) {
+	case *StatusError:
+		return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+	case *BodyLimitError:
+		return false
+	}
+	return true
+}
+
+func do(ctx context.Context, client *http.Client, cfg Config, req *http.Request) ([]byte, http.Header, error) {
+	res, err := client.Do(req.WithContext(ctx))
 	if err != nil {
-		return nil, err
+		if e, ok := err.(*url.Error); ok {
+			e.URL = redactURL(e.URL)
+		}
+		return nil, nil, err
 	}
 	defer res.Body.Close()
 
-	return ioutil.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, nil, &StatusError{
+			Method:     req.Method,
+			URL:        req.URL.String(),
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+		}
+	}
+
+	var r io.Reader = res.Body
+	if cfg.MaxBodySize > 0 {
+		r = io.LimitReader(r, cfg.MaxBodySize+1)
+	}
+
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.MaxBodySize > 0 && int64(len(body)) > cfg.MaxBodySize {
+		return nil, nil, &BodyLimitError{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Limit:  cfg.MaxBodySize,
+		}
+	}
+	return body, res.Header, nil
+}
+
+// Do sends req with the shared client and returns the response body,
+// retrying idempotent requests whose body, if any, can be sent again.
+func Do(ctx context.Context, req *http.Request) ([]byte, error) {
+	body, _, err := doWithRetries(ctx, req)
+	return body, err
+}
+
+func doWithRetries(ctx context.Context, req *http.Request) ([]byte, http.Header, error) {
+	client, cfg := current()
+	if len(cfg.UserAgent) > 0 && len(req.Header.Get("User-Agent")) == 0 {
+		req.Header.Set("User-Agent", cfg.UserAgent)
+	}
+
+	retries := cfg.Retries
+	if !idempotent(req.Method) || (req.Body != nil && req.GetBody == nil) {
+		retries = 0
+	}
+
+	backoff := cfg.Backoff
+	for i := 0; ; i++ {
+		if i > 0 && req.GetBody != nil {
+			b, err := req.GetBody()
+			if err != nil {
+				return nil, nil, err
+			}
+			req.Body = b
+		}
+
+		body, header, err := do(ctx, client, cfg, req)
+		if err == nil || i >= retries || !retryable(err) || ctx.Err() != nil {
+			return body, header, err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// GetOption customizes a GET request.
+type GetOption func(*getOptions)
+
+type getOptions struct {
+	cacheTTL time.Duration
+}
+
+// WithCache caches the response for up to ttl, or less if its Cache-Control
+// says so. Concurrent identical requests asking for caching share a single
+// request.
+func WithCache(ttl time.Duration) GetOption {
+	return func(o *getOptions) {
+		o.cacheTTL = ttl
+	}
+}
+
+func GetBody(ctx context.Context, url string, opts ...GetOption) ([]byte, error) {
+	var o getOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	fetch := func(ctx context.Context) ([]byte, http.Header, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		return doWithRetries(ctx, req)
+	}
+
+	if o.cacheTTL > 0 {
+		return getCached(ctx, url, o.cacheTTL, fetch)
+	}
+
+	body, _, err := fetch(ctx)
+	return body, err
 }
 
-func GetJSON(url string, v interface{}) error {
-	body, err := GetBody(url)
+func GetJSON(ctx context.Context, url string, v interface{}, opts ...GetOption) error {
+	body, err := GetBody(ctx, url, opts...)
 	if err != nil {
 		return err
 	}